@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	// Embed the IANA time zone database so profile time zones validate in
+	// images without tzdata
+	_ "time/tzdata"
+
 	_ "otp-auth-backend/docs"
 
 	"github.com/gin-gonic/gin"
@@ -18,9 +22,15 @@ import (
 
 	"otp-auth-backend/config"
 	"otp-auth-backend/handlers"
+	"otp-auth-backend/logging"
+	"otp-auth-backend/metrics"
 	"otp-auth-backend/middleware"
+	"otp-auth-backend/models"
+	"otp-auth-backend/sender"
+	"otp-auth-backend/server"
 	"otp-auth-backend/service"
 	"otp-auth-backend/store"
+	"otp-auth-backend/tracing"
 )
 
 // @title OTP Authentication Backend API
@@ -48,63 +58,130 @@ func main() {
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
+	}
+
+	// Structured logging with PII redaction, also used by the standard log package
+	logger, err := logging.New(&cfg.Log, os.Stdout)
+	if err != nil {
+		fatal("Failed to initialize logger", err)
+	}
+	slog.SetDefault(logger)
+
+	// Tracing with W3C trace context propagation
+	shutdownTracing, err := tracing.Setup(context.Background(), &cfg.Tracing)
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
 	}
 
 	// Initialize database
-	db, err := store.NewDatabase(&cfg.Database)
+	db, err := store.NewDatabase(&cfg.Database, store.GoMigrations(&cfg.Phone)...)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
 	defer db.Close()
 
 	// Initialize Redis
 	redisStore, err := store.NewRedisStore(&cfg.Redis)
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		fatal("Failed to connect to Redis", err)
 	}
 	defer redisStore.Close()
 
 	// Initialize repositories
 	userRepo := store.NewUserRepository(db)
+	sessionRepo := store.NewSessionRepository(db)
+	auditRepo := store.NewAuditRepository(db)
+
+	// Initialize OTP sender
+	otpSender, err := sender.New(&cfg.OTP)
+	if err != nil {
+		fatal("Failed to initialize OTP sender", err)
+	}
+	logger.Info("OTP delivery provider configured", "provider", otpSender.Name())
+	if cfg.OTP.AcceptPlaintext {
+		logger.Warn("OTP_ACCEPT_PLAINTEXT is enabled; turn it off once codes issued before the upgrade have expired",
+			"otp_expiration", cfg.OTP.Expiration.String())
+	}
+
+	// Load JWT signing keys
+	keySet, err := service.LoadKeySet(&cfg.JWT)
+	if err != nil {
+		fatal("Failed to load JWT keys", err)
+	}
 
 	// Initialize services
-	otpService := service.NewOTPService(redisStore, cfg)
-	authService := service.NewAuthService(otpService, userRepo, cfg)
-	userService := service.NewUserService(userRepo)
+	otpService := service.NewOTPService(redisStore, otpSender, cfg)
+	authService := service.NewAuthService(otpService, userRepo, sessionRepo, auditRepo, redisStore, keySet, cfg)
+	userService := service.NewUserService(userRepo, auditRepo)
+	sessionService := service.NewSessionService(sessionRepo, redisStore)
+	accountService := service.NewAccountService(userRepo, sessionRepo, auditRepo, redisStore, authService, cfg)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(otpService, authService)
+	authHandler := handlers.NewAuthHandler(authService)
 	userHandler := handlers.NewUserHandler(userService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+	healthHandler := handlers.NewHealthHandler(db.DB, redisStore.GetClient(), &cfg.Health)
 
 	// Initialize Gin router
-	router := gin.Default()
+	router := gin.New()
 
-	// Add CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	// Only these proxies may set the client IP through X-Forwarded-For; gin
+	// trusts every peer otherwise and clients could pick their own IP
+	if err := router.SetTrustedProxies(cfg.Security.TrustedProxies); err != nil {
+		fatal("Invalid TRUSTED_PROXIES", err)
+	}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	router.Use(
+		middleware.RequestIDMiddleware(cfg.Security.TrustedProxies),
+		middleware.TracingMiddleware(),
+		middleware.RequestLogger(logger),
+		middleware.RecoveryMiddleware(),
+	)
 
-		c.Next()
-	})
+	// Request latency histograms
+	if cfg.Metrics.Enabled {
+		router.Use(middleware.MetricsMiddleware())
+	}
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-			"time":   time.Now().Format(time.RFC3339),
-		})
-	})
+	// CORS allowlist and security headers
+	router.Use(middleware.SecurityMiddleware(cfg))
+
+	// Distributed rate limiting shared by all replicas
+	router.Use(middleware.RateLimitMiddleware(cfg, redisStore))
+
+	// Probe endpoints only report a status, so load balancers can reach them
+	router.GET("/livez", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+
+	// Operator endpoints expose runtime and dependency details
+	internal := router.Group("/")
+	if cfg.Metrics.RequireClientCert {
+		internal.Use(middleware.RequireClientCert())
+	} else {
+		logger.Warn("/health and /metrics are reachable without authentication; set METRICS_REQUIRE_CLIENT_CERT with TLS_CLIENT_AUTH to restrict them")
+	}
+	internal.GET("/health", healthHandler.HealthCheck)
+
+	// Prometheus metrics
+	if cfg.Metrics.Enabled {
+		metrics.RegisterDatabase(db.DB, cfg.Database.DBName)
+		metrics.RegisterRedis(redisStore.GetClient())
+
+		internal.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
+
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
 
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	authMiddleware := middleware.AuthMiddleware(authService)
+	// Registered again after authentication to apply per-user policies
+	userRateLimit := middleware.RateLimitMiddleware(cfg, redisStore)
+
 	// API routes
 	api := router.Group("/api/v1")
 	{
@@ -113,19 +190,38 @@ func main() {
 		{
 			auth.POST("/request-otp", authHandler.RequestOTP)
 			auth.POST("/verify-otp", authHandler.VerifyOTP)
+			auth.POST("/refresh", authHandler.RefreshToken)
+			auth.POST("/logout", authMiddleware, authHandler.Logout)
+			auth.POST("/logout-all", authMiddleware, authHandler.LogoutAll)
 		}
 
 		// User routes (authentication required)
 		users := api.Group("/users")
-		users.Use(middleware.AuthMiddleware(authService))
+		users.Use(authMiddleware, userRateLimit)
 		{
-			users.GET("", userHandler.ListUsers)
+			users.GET("", middleware.RequirePermission(models.PermissionListUsers), userHandler.ListUsers)
+			// Users can read their own record; others need users:read, checked in the handler
 			users.GET("/:id", userHandler.GetUserByID)
+			users.PUT("/:id/status", middleware.RequirePermission(models.PermissionManageUsers), accountHandler.UpdateUserStatus)
+		}
+
+		// Current user routes (authentication required)
+		me := api.Group("/me")
+		me.Use(authMiddleware, userRateLimit)
+		{
+			me.GET("", userHandler.GetMe)
+			me.PATCH("", userHandler.UpdateMe)
+			me.DELETE("", accountHandler.DeleteMe)
+			me.GET("/export", accountHandler.ExportMe)
+			me.POST("/phone", authHandler.RequestPhoneChange)
+			me.POST("/phone/verify", authHandler.VerifyPhoneChange)
+			me.GET("/sessions", sessionHandler.ListSessions)
+			me.DELETE("/sessions/:id", sessionHandler.RevokeSession)
 		}
 	}
 
 	// Enhanced server configuration
-	server := &http.Server{
+	httpServer := &http.Server{
 		Addr:         fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
 		Handler:      router,
 		ReadTimeout:  15 * time.Second,
@@ -133,29 +229,103 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	// Hard-delete accounts once their purge delay has passed
+	go accountService.RunPurger(watchCtx, cfg.Account.PurgeInterval)
+
+	scheme := "http"
+	var redirectServer *http.Server
+	if cfg.Security.EnableHTTPS {
+		scheme = "https"
+
+		reloader, err := server.NewCertReloader(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+		if err != nil {
+			fatal("Failed to load TLS certificate", err)
+		}
+		go reloader.Watch(watchCtx, cfg.Server.TLS.ReloadInterval)
+
+		httpServer.TLSConfig, err = server.NewTLSConfig(&cfg.Server.TLS, reloader)
+		if err != nil {
+			fatal("Failed to configure TLS", err)
+		}
+
+		if cfg.Server.TLS.RedirectPort != "" {
+			redirectServer = server.NewRedirectServer(
+				fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.TLS.RedirectPort), cfg.Server.Port)
+		}
+	}
+
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Starting server on %s:%s", cfg.Server.Host, cfg.Server.Port)
-		log.Printf("Health check available at: http://%s:%s/health", cfg.Server.Host, cfg.Server.Port)
-		log.Printf("Swagger docs available at: http://%s:%s/swagger/index.html", cfg.Server.Host, cfg.Server.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+		baseURL := fmt.Sprintf("%s://%s:%s", scheme, cfg.Server.Host, cfg.Server.Port)
+		logger.Info("Starting server",
+			"addr", httpServer.Addr,
+			"scheme", scheme,
+			"health_url", baseURL+"/health",
+			"swagger_url", baseURL+"/swagger/index.html",
+		)
+
+		var err error
+		if cfg.Security.EnableHTTPS {
+			// Certificates come from TLSConfig.GetCertificate
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("Failed to start server", err)
 		}
 	}()
 
+	if redirectServer != nil {
+		go func() {
+			logger.Info("Redirecting HTTP to HTTPS", "addr", redirectServer.Addr)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Failed to start HTTP redirect server", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	logger.Info("Shutting down server")
+	stopWatch()
+
+	// Fail readiness first so load balancers stop sending new requests
+	healthHandler.SetShuttingDown()
+	if cfg.Health.ShutdownDrainDelay > 0 {
+		logger.Info("Waiting for load balancers to drain", "delay", cfg.Health.ShutdownDrainDelay.String())
+		time.Sleep(cfg.Health.ShutdownDrainDelay)
+	}
 
 	// Create a deadline for server shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+	if redirectServer != nil {
+		if err := redirectServer.Shutdown(ctx); err != nil {
+			logger.Warn("HTTP redirect server forced to shutdown", "error", err)
+		}
 	}
 
-	log.Println("Server exited")
+	if err := httpServer.Shutdown(ctx); err != nil {
+		fatal("Server forced to shutdown", err)
+	}
+
+	// Flush spans that are still buffered
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn("Failed to flush traces", "error", err)
+	}
+
+	logger.Info("Server exited")
+}
+
+// fatal logs err and exits. Deferred cleanups do not run, as with log.Fatal.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"otp-auth-backend/config"
+	"otp-auth-backend/migrations"
+	"otp-auth-backend/store"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up          Apply all pending migrations
+  down [N]    Revert the last N migrations (default 1)
+  status      Show the current schema version and pending migrations`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Connect without running migrations on startup
+	cfg.Database.MigrationMode = store.MigrationModeOff
+	db, err := store.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := store.NewMigrator(db.DB, migrations.FS, store.GoMigrations(&cfg.Phone)...)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		log.Printf("Applied %d migrations", applied)
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps: %s", os.Args[2])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		log.Printf("Reverted %d migrations", reverted)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		fmt.Printf("Current version: %d\n", status.Current)
+		fmt.Printf("Latest version:  %d\n", status.Latest)
+		for _, migration := range status.Pending {
+			fmt.Printf("Pending:         %d_%s\n", migration.Version, migration.Name)
+		}
+		for _, version := range status.Unknown {
+			fmt.Printf("Unknown:         %d (applied by a newer binary)\n", version)
+		}
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
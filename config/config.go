@@ -1,12 +1,16 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"otp-auth-backend/phone"
+
 	"github.com/joho/godotenv"
 )
 
@@ -16,13 +20,40 @@ type Config struct {
 	Redis     RedisConfig
 	JWT       JWTConfig
 	OTP       OTPConfig
+	Phone     PhoneConfig
+	Account   AccountConfig
 	RateLimit RateLimitConfig
+	Health    HealthConfig
+	Metrics   MetricsConfig
+	Log       LogConfig
+	Tracing   TracingConfig
 	Security  SecurityConfig
 }
 
 type ServerConfig struct {
 	Port string
 	Host string
+	TLS  TLSConfig
+}
+
+// Client certificate modes for TLS_CLIENT_AUTH
+const (
+	TLSClientAuthNone          = "none"
+	TLSClientAuthRequest       = "request"
+	TLSClientAuthVerifyIfGiven = "verify_if_given"
+	TLSClientAuthRequire       = "require"
+)
+
+// TLSConfig is used when ENABLE_HTTPS is set
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	MinVersion     string
+	CipherPolicy   string
+	ReloadInterval time.Duration
+	ClientAuth     string
+	ClientCAFile   string
+	RedirectPort   string
 }
 
 type DatabaseConfig struct {
@@ -36,6 +67,7 @@ type DatabaseConfig struct {
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
 	ConnMaxIdleTime time.Duration
+	MigrationMode   string
 }
 
 type RedisConfig struct {
@@ -53,28 +85,169 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	Expiration time.Duration
+	Secret            string
+	Algorithm         string
+	KeyDir            string
+	ActiveKeyID       string
+	Expiration        time.Duration
+	RefreshExpiration time.Duration
 }
 
+// Supported OTP alphabets
+const (
+	OTPAlphabetNumeric      = "numeric"
+	OTPAlphabetAlphanumeric = "alphanumeric"
+	OTPAlphabetHex          = "hex"
+)
+
+// otpPepperPlaceholder is the OTP_PEPPER value published in the examples
+const otpPepperPlaceholder = "your-otp-pepper-change-in-production"
+
 type OTPConfig struct {
-	Length     int
-	Expiration time.Duration
-	MaxRetries int
+	Length          int
+	Alphabet        string
+	Pepper          string
+	AcceptPlaintext bool
+	Expiration      time.Duration
+	MaxRetries      int
+	LockoutBase     time.Duration
+	LockoutMax      time.Duration
+	LockoutWindow   time.Duration
+	ResendCooldown  time.Duration
+	SendLimit       int // codes per phone per SendWindow, even without rate limiting
+	SendWindow      time.Duration
+	ReuseOnResend   bool
+	Sender          string
+	SenderConsole   bool
+	SenderFilePath  string
+	SenderHTTPURL   string
+	SenderTimeout   time.Duration
+}
+
+type PhoneConfig struct {
+	// DefaultRegion is the ISO 3166-1 alpha-2 region assumed for numbers
+	// given without a country code; empty requires the international format
+	DefaultRegion string
+	// ChangeVerifyOld requires a code sent to the current number, besides
+	// the one sent to the new number, to change a user's phone
+	ChangeVerifyOld bool
+}
+
+type AccountConfig struct {
+	// PurgeDelay is how long a deleted account is kept before it is removed
+	// for good, so that support can still restore it
+	PurgeDelay    time.Duration
+	PurgeInterval time.Duration
+}
+
+type HealthConfig struct {
+	CheckTimeout         time.Duration
+	RedisDegradedLatency time.Duration
+	ShutdownDrainDelay   time.Duration
+}
+
+type LogConfig struct {
+	Level  string
+	Format string
+}
+
+// Trace exporters for TRACING_EXPORTER
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+type TracingConfig struct {
+	Exporter     string
+	OTLPEndpoint string
+	OTLPInsecure bool
+	SampleRatio  float64
+	ServiceName  string
+}
+
+type MetricsConfig struct {
+	Enabled           bool
+	RequireClientCert bool
 }
 
 type RateLimitConfig struct {
-	MaxRequests int
-	Window      time.Duration
+	MaxRequests  int
+	Window       time.Duration
+	PoliciesFile string
+	Policies     []RateLimitPolicy
+}
+
+// Rate limit dimensions a policy can be keyed by
+const (
+	RateLimitDimensionIP          = "ip"
+	RateLimitDimensionPhone       = "phone"
+	RateLimitDimensionPhonePrefix = "phone_prefix"
+	RateLimitDimensionUser        = "user"
+	RateLimitDimensionGlobal      = "global"
+)
+
+// RateLimitPolicy limits requests to a route, counted separately per value of
+// the dimension. Route is "METHOD /path" as registered on the router, or "*"
+// for every route.
+type RateLimitPolicy struct {
+	Name         string
+	Route        string
+	Dimension    string
+	Limit        int
+	Window       time.Duration
+	PrefixLength int
+}
+
+func (p *RateLimitPolicy) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name         string `json:"name"`
+		Route        string `json:"route"`
+		Dimension    string `json:"dimension"`
+		Limit        int    `json:"limit"`
+		Window       string `json:"window"`
+		PrefixLength int    `json:"prefix_length"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	window, err := time.ParseDuration(raw.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window for rate limit policy %q: %w", raw.Name, err)
+	}
+
+	*p = RateLimitPolicy{
+		Name:         raw.Name,
+		Route:        raw.Route,
+		Dimension:    raw.Dimension,
+		Limit:        raw.Limit,
+		Window:       window,
+		PrefixLength: raw.PrefixLength,
+	}
+	return nil
 }
 
 type SecurityConfig struct {
-	JWTSecretFile   string
-	AllowedOrigins  []string
-	EnableHTTPS     bool
-	TrustedProxies  []string
-	EnableCORS      bool
-	EnableRateLimit bool
+	JWTSecretFile      string
+	OTPPepperFile      string
+	AllowedOrigins     []string
+	CORSRouteOverrides []CORSRouteOverride
+	CORSExposedHeaders []string
+	CORSMaxAge         time.Duration
+	EnableHTTPS        bool
+	HSTSMaxAge         time.Duration
+	TrustedProxies     []string
+	AdminPhones        []string
+	EnableCORS         bool
+	EnableRateLimit    bool
+}
+
+// CORSRouteOverride replaces ALLOWED_ORIGINS for request paths starting with
+// PathPrefix. The longest matching prefix wins.
+type CORSRouteOverride struct {
+	PathPrefix string
+	Origins    []string
 }
 
 func Load() (*Config, error) {
@@ -85,6 +258,16 @@ func Load() (*Config, error) {
 		Server: ServerConfig{
 			Port: getEnv("SERVER_PORT", "8080"),
 			Host: getEnv("SERVER_HOST", "0.0.0.0"),
+			TLS: TLSConfig{
+				CertFile:       getEnv("TLS_CERT_FILE", ""),
+				KeyFile:        getEnv("TLS_KEY_FILE", ""),
+				MinVersion:     getEnv("TLS_MIN_VERSION", "1.2"),
+				CipherPolicy:   strings.ToLower(getEnv("TLS_CIPHER_POLICY", "default")),
+				ReloadInterval: getEnvAsDuration("TLS_RELOAD_INTERVAL", 1*time.Minute),
+				ClientAuth:     strings.ToLower(getEnv("TLS_CLIENT_AUTH", TLSClientAuthNone)),
+				ClientCAFile:   getEnv("TLS_CLIENT_CA_FILE", ""),
+				RedirectPort:   getEnv("TLS_REDIRECT_PORT", ""),
+			},
 		},
 		Database: DatabaseConfig{
 			Host:            getEnv("DB_HOST", "localhost"),
@@ -97,6 +280,7 @@ func Load() (*Config, error) {
 			MaxIdleConns:    getEnvAsInt("DB_MAX_IDLE_CONNS", 25),
 			ConnMaxLifetime: getEnvAsDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
 			ConnMaxIdleTime: getEnvAsDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+			MigrationMode:   getEnv("DB_MIGRATION_MODE", "up"),
 		},
 		Redis: RedisConfig{
 			Host:         getEnv("REDIS_HOST", "localhost"),
@@ -112,23 +296,77 @@ func Load() (*Config, error) {
 			PoolTimeout:  getEnvAsDuration("REDIS_POOL_TIMEOUT", 4*time.Second),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-			Expiration: getEnvAsDuration("JWT_EXPIRATION", 7*24*time.Hour), // 7 days
+			Secret:            getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+			Algorithm:         getEnv("JWT_ALGORITHM", "HS256"),
+			KeyDir:            getEnv("JWT_KEY_DIR", ""),
+			ActiveKeyID:       getEnv("JWT_ACTIVE_KEY_ID", ""),
+			Expiration:        getEnvAsDuration("JWT_EXPIRATION", 15*time.Minute),
+			RefreshExpiration: getEnvAsDuration("JWT_REFRESH_EXPIRATION", 30*24*time.Hour), // 30 days
 		},
 		OTP: OTPConfig{
-			Length:     getEnvAsInt("OTP_LENGTH", 6),
-			Expiration: getEnvAsDuration("OTP_EXPIRATION", 2*time.Minute),
-			MaxRetries: getEnvAsInt("OTP_MAX_RETRIES", 3),
+			Length:          getEnvAsInt("OTP_LENGTH", 6),
+			Alphabet:        strings.ToLower(getEnv("OTP_ALPHABET", OTPAlphabetNumeric)),
+			Pepper:          getEnv("OTP_PEPPER", ""),
+			AcceptPlaintext: getEnvAsBool("OTP_ACCEPT_PLAINTEXT", false), // temporary, for upgrades only
+			Expiration:      getEnvAsDuration("OTP_EXPIRATION", 2*time.Minute),
+			MaxRetries:      getEnvAsInt("OTP_MAX_RETRIES", 3),
+			LockoutBase:     getEnvAsDuration("OTP_LOCKOUT_DURATION", 5*time.Minute),
+			LockoutMax:      getEnvAsDuration("OTP_LOCKOUT_MAX_DURATION", 24*time.Hour),
+			LockoutWindow:   getEnvAsDuration("OTP_LOCKOUT_WINDOW", 24*time.Hour),
+			ResendCooldown:  getEnvAsDuration("OTP_RESEND_COOLDOWN", 30*time.Second),
+			SendLimit:       getEnvAsInt("OTP_SEND_LIMIT", 10),
+			SendWindow:      getEnvAsDuration("OTP_SEND_WINDOW", time.Hour),
+			ReuseOnResend:   getEnvAsBool("OTP_REUSE_ON_RESEND", false),
+			Sender:          getEnv("OTP_SENDER", "console"),
+			SenderConsole:   getEnvAsBool("OTP_SENDER_CONSOLE_ENABLED", false),
+			SenderFilePath:  getEnv("OTP_SENDER_FILE_PATH", ""),
+			SenderHTTPURL:   getEnv("OTP_SENDER_HTTP_URL", ""),
+			SenderTimeout:   getEnvAsDuration("OTP_SENDER_TIMEOUT", 5*time.Second),
+		},
+		Phone: PhoneConfig{
+			DefaultRegion:   strings.ToUpper(getEnv("PHONE_DEFAULT_REGION", "US")),
+			ChangeVerifyOld: getEnvAsBool("PHONE_CHANGE_VERIFY_OLD", false),
+		},
+		Account: AccountConfig{
+			PurgeDelay:    getEnvAsDuration("ACCOUNT_PURGE_DELAY", 30*24*time.Hour), // 30 days
+			PurgeInterval: getEnvAsDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
 		},
 		RateLimit: RateLimitConfig{
-			MaxRequests: getEnvAsInt("RATE_LIMIT_MAX_REQUESTS", 100),
-			Window:      getEnvAsDuration("RATE_LIMIT_WINDOW", 1*time.Minute),
+			MaxRequests:  getEnvAsInt("RATE_LIMIT_MAX_REQUESTS", 100),
+			Window:       getEnvAsDuration("RATE_LIMIT_WINDOW", 1*time.Minute),
+			PoliciesFile: getEnv("RATE_LIMIT_POLICIES_FILE", ""),
+		},
+		Health: HealthConfig{
+			CheckTimeout:         getEnvAsDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+			RedisDegradedLatency: getEnvAsDuration("HEALTH_REDIS_DEGRADED_LATENCY", 100*time.Millisecond),
+			ShutdownDrainDelay:   getEnvAsDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		},
+		Log: LogConfig{
+			Level:  strings.ToLower(getEnv("LOG_LEVEL", "info")),
+			Format: strings.ToLower(getEnv("LOG_FORMAT", "json")),
+		},
+		Tracing: TracingConfig{
+			Exporter:     strings.ToLower(getEnv("TRACING_EXPORTER", TracingExporterNone)),
+			OTLPEndpoint: getEnv("TRACING_OTLP_ENDPOINT", "localhost:4318"),
+			OTLPInsecure: getEnvAsBool("TRACING_OTLP_INSECURE", true),
+			SampleRatio:  getEnvAsFloat("TRACING_SAMPLE_RATIO", 1.0),
+			ServiceName:  getEnv("TRACING_SERVICE_NAME", "otp-auth-backend"),
+		},
+		Metrics: MetricsConfig{
+			Enabled:           getEnvAsBool("METRICS_ENABLED", true),
+			RequireClientCert: getEnvAsBool("METRICS_REQUIRE_CLIENT_CERT", false),
 		},
 		Security: SecurityConfig{
-			JWTSecretFile:   getEnv("JWT_SECRET_FILE", ""),
-			AllowedOrigins:  strings.Split(getEnv("ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:8080"), ","),
+			JWTSecretFile:  getEnv("JWT_SECRET_FILE", ""),
+			OTPPepperFile:  getEnv("OTP_PEPPER_FILE", ""),
+			AllowedOrigins: getEnvAsList("ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:8080"),
+			CORSExposedHeaders: getEnvAsList("CORS_EXPOSED_HEADERS",
+				"RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,Retry-After,X-Request-ID"),
+			CORSMaxAge:      getEnvAsDuration("CORS_MAX_AGE", 10*time.Minute),
 			EnableHTTPS:     getEnvAsBool("ENABLE_HTTPS", false),
-			TrustedProxies:  strings.Split(getEnv("TRUSTED_PROXIES", "127.0.0.1,::1"), ","),
+			HSTSMaxAge:      getEnvAsDuration("HSTS_MAX_AGE", 365*24*time.Hour),
+			TrustedProxies:  getEnvAsList("TRUSTED_PROXIES", "127.0.0.1,::1"),
+			AdminPhones:     getEnvAsList("ADMIN_PHONES", ""),
 			EnableCORS:      getEnvAsBool("ENABLE_CORS", true),
 			EnableRateLimit: getEnvAsBool("ENABLE_RATE_LIMIT", true),
 		},
@@ -143,9 +381,350 @@ func Load() (*Config, error) {
 		config.JWT.Secret = strings.TrimSpace(string(secretBytes))
 	}
 
+	// Load OTP pepper from file for production if specified
+	if config.Security.OTPPepperFile != "" {
+		pepperBytes, err := os.ReadFile(config.Security.OTPPepperFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OTP pepper file: %w", err)
+		}
+		config.OTP.Pepper = strings.TrimSpace(string(pepperBytes))
+	}
+
+	// Per-route CORS origins, e.g. "/.well-known/=*;/api/v1/auth/=https://*.example.com"
+	overrides, err := parseCORSRouteOverrides(getEnv("CORS_ROUTE_OVERRIDES", ""))
+	if err != nil {
+		return nil, err
+	}
+	config.Security.CORSRouteOverrides = overrides
+
+	// Load rate limit policies from file, or derive the defaults
+	if config.RateLimit.PoliciesFile != "" {
+		policyBytes, err := os.ReadFile(config.RateLimit.PoliciesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rate limit policies file: %w", err)
+		}
+		if err := json.Unmarshal(policyBytes, &config.RateLimit.Policies); err != nil {
+			return nil, fmt.Errorf("failed to parse rate limit policies file: %w", err)
+		}
+	} else {
+		config.RateLimit.Policies = defaultRateLimitPolicies(config.RateLimit)
+	}
+
+	// /health and /metrics are restricted by default whenever client
+	// certificates can be verified
+	if os.Getenv("METRICS_REQUIRE_CLIENT_CERT") == "" {
+		config.Metrics.RequireClientCert = config.verifiesClientCerts()
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	return config, nil
 }
 
+// verifiesClientCerts reports whether the server checks client certificates
+// against TLS_CLIENT_CA_FILE
+func (c *Config) verifiesClientCerts() bool {
+	clientAuth := c.Server.TLS.ClientAuth
+	return c.Security.EnableHTTPS && (clientAuth == TLSClientAuthVerifyIfGiven || clientAuth == TLSClientAuthRequire)
+}
+
+// Validate checks that the loaded configuration is usable
+func (c *Config) Validate() error {
+	switch c.Database.MigrationMode {
+	case "up", "verify", "off":
+	default:
+		return fmt.Errorf("DB_MIGRATION_MODE must be one of up, verify or off, got %q", c.Database.MigrationMode)
+	}
+
+	switch c.JWT.Algorithm {
+	case "HS256":
+		if c.JWT.Secret == "" {
+			return fmt.Errorf("JWT_SECRET must not be empty when JWT_ALGORITHM is HS256")
+		}
+	case "RS256", "ES256", "EdDSA":
+		if c.JWT.KeyDir == "" || c.JWT.ActiveKeyID == "" {
+			return fmt.Errorf("JWT_KEY_DIR and JWT_ACTIVE_KEY_ID are required when JWT_ALGORITHM is %s", c.JWT.Algorithm)
+		}
+	default:
+		return fmt.Errorf("JWT_ALGORITHM must be one of HS256, RS256, ES256 or EdDSA, got %q", c.JWT.Algorithm)
+	}
+
+	if c.JWT.Expiration <= 0 || c.JWT.RefreshExpiration <= c.JWT.Expiration {
+		return fmt.Errorf("JWT_REFRESH_EXPIRATION (%v) must be longer than JWT_EXPIRATION (%v)",
+			c.JWT.RefreshExpiration, c.JWT.Expiration)
+	}
+
+	names := make(map[string]bool, len(c.RateLimit.Policies))
+	for _, policy := range c.RateLimit.Policies {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		if names[policy.Name] {
+			return fmt.Errorf("duplicate rate limit policy %q", policy.Name)
+		}
+		names[policy.Name] = true
+	}
+
+	if c.OTP.Length < 4 || c.OTP.Length > 12 {
+		return fmt.Errorf("OTP_LENGTH must be between 4 and 12, got %d", c.OTP.Length)
+	}
+
+	switch c.OTP.Alphabet {
+	case OTPAlphabetNumeric, OTPAlphabetAlphanumeric, OTPAlphabetHex:
+	default:
+		return fmt.Errorf("OTP_ALPHABET must be one of %s, %s or %s, got %q",
+			OTPAlphabetNumeric, OTPAlphabetAlphanumeric, OTPAlphabetHex, c.OTP.Alphabet)
+	}
+
+	if c.OTP.MaxRetries < 1 {
+		return fmt.Errorf("OTP_MAX_RETRIES must be at least 1, got %d", c.OTP.MaxRetries)
+	}
+
+	// A lockout without a TTL reads as not locked, which would silently
+	// disable it
+	if c.OTP.LockoutBase <= 0 {
+		return fmt.Errorf("OTP_LOCKOUT_DURATION must be positive, got %v", c.OTP.LockoutBase)
+	}
+	if c.OTP.LockoutMax < c.OTP.LockoutBase {
+		return fmt.Errorf("OTP_LOCKOUT_MAX_DURATION must be at least OTP_LOCKOUT_DURATION (%v), got %v",
+			c.OTP.LockoutBase, c.OTP.LockoutMax)
+	}
+	if c.OTP.LockoutWindow <= 0 {
+		return fmt.Errorf("OTP_LOCKOUT_WINDOW must be positive, got %v", c.OTP.LockoutWindow)
+	}
+
+	// A known pepper lets anyone with Redis access brute force the small
+	// code space offline, so it must be set to a secret value
+	if c.OTP.Pepper == "" {
+		return fmt.Errorf("OTP_PEPPER (or OTP_PEPPER_FILE) is required")
+	}
+	if c.OTP.Pepper == otpPepperPlaceholder {
+		return fmt.Errorf("OTP_PEPPER must be changed from the example value")
+	}
+
+	if c.OTP.Expiration <= 0 {
+		return fmt.Errorf("OTP_EXPIRATION must be positive, got %v", c.OTP.Expiration)
+	}
+
+	if c.OTP.ResendCooldown < 0 || c.OTP.ResendCooldown >= c.OTP.Expiration {
+		return fmt.Errorf("OTP_RESEND_COOLDOWN must be between 0 and OTP_EXPIRATION (%v), got %v",
+			c.OTP.Expiration, c.OTP.ResendCooldown)
+	}
+
+	if c.OTP.SendLimit < 1 {
+		return fmt.Errorf("OTP_SEND_LIMIT must be at least 1, got %d", c.OTP.SendLimit)
+	}
+	if c.OTP.SendWindow <= 0 {
+		return fmt.Errorf("OTP_SEND_WINDOW must be positive, got %v", c.OTP.SendWindow)
+	}
+
+	if c.Phone.DefaultRegion != "" && !phone.ValidRegion(c.Phone.DefaultRegion) {
+		return fmt.Errorf("PHONE_DEFAULT_REGION must be an ISO 3166-1 alpha-2 region code, got %q", c.Phone.DefaultRegion)
+	}
+
+	for _, adminPhone := range c.Security.AdminPhones {
+		if _, err := phone.Normalize(adminPhone, c.Phone.DefaultRegion); err != nil {
+			return fmt.Errorf("ADMIN_PHONES: %q is %w", adminPhone, err)
+		}
+	}
+
+	if c.Account.PurgeDelay < 0 {
+		return fmt.Errorf("ACCOUNT_PURGE_DELAY must not be negative, got %v", c.Account.PurgeDelay)
+	}
+
+	if c.Account.PurgeInterval <= 0 {
+		return fmt.Errorf("ACCOUNT_PURGE_INTERVAL must be positive, got %v", c.Account.PurgeInterval)
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("LOG_LEVEL must be one of debug, info, warn or error, got %q", c.Log.Level)
+	}
+
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		return fmt.Errorf("LOG_FORMAT must be json or text, got %q", c.Log.Format)
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterStdout, TracingExporterOTLP:
+	default:
+		return fmt.Errorf("TRACING_EXPORTER must be one of %s, %s or %s, got %q",
+			TracingExporterNone, TracingExporterStdout, TracingExporterOTLP, c.Tracing.Exporter)
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("TRACING_SAMPLE_RATIO must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if c.Health.CheckTimeout <= 0 {
+		return fmt.Errorf("HEALTH_CHECK_TIMEOUT must be positive, got %v", c.Health.CheckTimeout)
+	}
+
+	if c.Health.ShutdownDrainDelay < 0 {
+		return fmt.Errorf("SHUTDOWN_DRAIN_DELAY must not be negative, got %v", c.Health.ShutdownDrainDelay)
+	}
+
+	if c.Metrics.RequireClientCert {
+		if !c.verifiesClientCerts() {
+			return fmt.Errorf("METRICS_REQUIRE_CLIENT_CERT needs ENABLE_HTTPS and TLS_CLIENT_AUTH set to %s or %s",
+				TLSClientAuthVerifyIfGiven, TLSClientAuthRequire)
+		}
+	}
+
+	if c.Security.EnableCORS {
+		for _, origin := range c.Security.AllowedOrigins {
+			if err := validateOriginPattern(origin); err != nil {
+				return fmt.Errorf("ALLOWED_ORIGINS: %w", err)
+			}
+		}
+		for _, override := range c.Security.CORSRouteOverrides {
+			for _, origin := range override.Origins {
+				if err := validateOriginPattern(origin); err != nil {
+					return fmt.Errorf("CORS_ROUTE_OVERRIDES for %s: %w", override.PathPrefix, err)
+				}
+			}
+		}
+		if c.Security.CORSMaxAge < 0 {
+			return fmt.Errorf("CORS_MAX_AGE must not be negative, got %v", c.Security.CORSMaxAge)
+		}
+	}
+
+	if c.Security.EnableHTTPS {
+		if c.Security.HSTSMaxAge <= 0 {
+			return fmt.Errorf("HSTS_MAX_AGE must be positive, got %v", c.Security.HSTSMaxAge)
+		}
+		if err := c.Server.TLS.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t TLSConfig) validate() error {
+	if t.CertFile == "" || t.KeyFile == "" {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE are required when ENABLE_HTTPS is true")
+	}
+
+	switch t.MinVersion {
+	case "1.2", "1.3":
+	default:
+		return fmt.Errorf("TLS_MIN_VERSION must be 1.2 or 1.3, got %q", t.MinVersion)
+	}
+
+	switch t.CipherPolicy {
+	case "default", "strict":
+	default:
+		return fmt.Errorf("TLS_CIPHER_POLICY must be default or strict, got %q", t.CipherPolicy)
+	}
+
+	if t.ReloadInterval < 0 {
+		return fmt.Errorf("TLS_RELOAD_INTERVAL must not be negative, got %v", t.ReloadInterval)
+	}
+
+	switch t.ClientAuth {
+	case TLSClientAuthNone, TLSClientAuthRequest:
+	case TLSClientAuthVerifyIfGiven, TLSClientAuthRequire:
+		if t.ClientCAFile == "" {
+			return fmt.Errorf("TLS_CLIENT_CA_FILE is required when TLS_CLIENT_AUTH is %s", t.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("TLS_CLIENT_AUTH must be one of %s, %s, %s or %s, got %q",
+			TLSClientAuthNone, TLSClientAuthRequest, TLSClientAuthVerifyIfGiven, TLSClientAuthRequire, t.ClientAuth)
+	}
+
+	return nil
+}
+
+// validateOriginPattern accepts "*", an exact origin such as
+// https://app.example.com, or a subdomain pattern such as https://*.example.com
+func validateOriginPattern(pattern string) error {
+	if pattern == "*" {
+		return nil
+	}
+
+	u, err := url.Parse(pattern)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return fmt.Errorf("invalid origin %q", pattern)
+	}
+
+	host := strings.TrimPrefix(u.Hostname(), "*.")
+	if host == "" || strings.Contains(host, "*") {
+		return fmt.Errorf("invalid origin %q: only a leading *. wildcard is supported", pattern)
+	}
+
+	return nil
+}
+
+// parseCORSRouteOverrides parses "prefix=origin,origin;prefix=origin" lists
+func parseCORSRouteOverrides(value string) ([]CORSRouteOverride, error) {
+	var overrides []CORSRouteOverride
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		prefix, origins, ok := strings.Cut(entry, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid CORS_ROUTE_OVERRIDES entry %q: expected /path=origin,origin", entry)
+		}
+
+		overrides = append(overrides, CORSRouteOverride{
+			PathPrefix: prefix,
+			Origins:    splitList(origins),
+		})
+	}
+
+	return overrides, nil
+}
+
+func (p RateLimitPolicy) validate() error {
+	if p.Name == "" || p.Route == "" {
+		return fmt.Errorf("rate limit policies need a name and a route")
+	}
+
+	switch p.Dimension {
+	case RateLimitDimensionIP, RateLimitDimensionPhone, RateLimitDimensionUser, RateLimitDimensionGlobal:
+	case RateLimitDimensionPhonePrefix:
+		if p.PrefixLength < 1 {
+			return fmt.Errorf("rate limit policy %q needs a positive prefix_length", p.Name)
+		}
+	default:
+		return fmt.Errorf("rate limit policy %q has unknown dimension %q", p.Name, p.Dimension)
+	}
+
+	if p.Limit < 1 || p.Window <= 0 {
+		return fmt.Errorf("rate limit policy %q needs a positive limit and window", p.Name)
+	}
+
+	return nil
+}
+
+// defaultRateLimitPolicies keeps RATE_LIMIT_MAX_REQUESTS/RATE_LIMIT_WINDOW as
+// the per-IP and per-phone OTP budget and adds separate budgets for the other
+// sensitive routes
+func defaultRateLimitPolicies(cfg RateLimitConfig) []RateLimitPolicy {
+	return []RateLimitPolicy{
+		{Name: "ip", Route: "*", Dimension: RateLimitDimensionIP, Limit: cfg.MaxRequests, Window: cfg.Window},
+		{Name: "request-otp-phone", Route: "POST /api/v1/auth/request-otp", Dimension: RateLimitDimensionPhone, Limit: cfg.MaxRequests, Window: cfg.Window},
+		{Name: "request-otp-phone-prefix", Route: "POST /api/v1/auth/request-otp", Dimension: RateLimitDimensionPhonePrefix, PrefixLength: 7, Limit: 200, Window: time.Hour},
+		{Name: "verify-otp-ip", Route: "POST /api/v1/auth/verify-otp", Dimension: RateLimitDimensionIP, Limit: 30, Window: 10 * time.Minute},
+		{Name: "verify-otp-phone", Route: "POST /api/v1/auth/verify-otp", Dimension: RateLimitDimensionPhone, Limit: 10, Window: 10 * time.Minute},
+		{Name: "list-users-user", Route: "GET /api/v1/users", Dimension: RateLimitDimensionUser, Limit: 60, Window: time.Minute},
+		{Name: "change-phone-user", Route: "POST /api/v1/me/phone", Dimension: RateLimitDimensionUser, Limit: cfg.MaxRequests, Window: cfg.Window},
+		{Name: "change-phone-phone", Route: "POST /api/v1/me/phone", Dimension: RateLimitDimensionPhone, Limit: cfg.MaxRequests, Window: cfg.Window},
+		{Name: "verify-phone-change-user", Route: "POST /api/v1/me/phone/verify", Dimension: RateLimitDimensionUser, Limit: 10, Window: 10 * time.Minute},
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -162,6 +741,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -171,6 +759,21 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getEnvAsList splits a comma separated value, dropping empty entries
+func getEnvAsList(key, defaultValue string) []string {
+	return splitList(getEnv(key, defaultValue))
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
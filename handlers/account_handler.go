@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"otp-auth-backend/models"
+	"otp-auth-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AccountHandler struct {
+	accountService *service.AccountService
+}
+
+func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+	}
+}
+
+// DeleteMe godoc
+// @Summary Delete the current user's account
+// @Description Log out every session and delete the account. The phone number can be used to register again immediately; the stored data is permanently removed after the purge delay.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.AccountDeletionResponse
+// @Failure 401 {object} models.AuthError
+// @Failure 404 {object} models.AuthError
+// @Failure 500 {object} models.AuthError
+// @Router me [delete]
+func (h *AccountHandler) DeleteMe(c *gin.Context) {
+	response, err := h.accountService.DeleteAccount(c.Request.Context(), c.GetString("user_id"), clientInfo(c))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, models.AuthError{
+				Error:   "not_found",
+				Message: "User not found",
+			})
+			return
+		}
+
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to delete account: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportMe godoc
+// @Summary Export the current user's data
+// @Description Download everything stored about the current user, including all sessions and audit events, as a JSON file
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.AccountExport
+// @Failure 401 {object} models.AuthError
+// @Failure 404 {object} models.AuthError
+// @Failure 500 {object} models.AuthError
+// @Router me/export [get]
+func (h *AccountHandler) ExportMe(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	export, err := h.accountService.ExportAccount(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, models.AuthError{
+				Error:   "not_found",
+				Message: "User not found",
+			})
+			return
+		}
+
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to export account: " + err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="account-export-%s.json"`, userID))
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, export)
+}
+
+// UpdateUserStatus godoc
+// @Summary Suspend, ban or reactivate a user
+// @Description Change the account status of a user. Suspended and banned users cannot sign in and their existing tokens stop working; clients receive the account_suspended error. A suspension may end at expires_at, bans last until lifted. Requires the users:manage permission; users who have it themselves, such as admins, cannot be suspended or banned.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body models.UpdateStatusRequest true "New status"
+// @Security BearerAuth
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} models.AuthError
+// @Failure 401 {object} models.AuthError
+// @Failure 403 {object} models.AuthError
+// @Failure 404 {object} models.AuthError
+// @Failure 500 {object} models.AuthError
+// @Router users/{id}/status [put]
+func (h *AccountHandler) UpdateUserStatus(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.AuthError{
+			Error:   "validation_error",
+			Message: "User ID must be a valid UUID",
+		})
+		return
+	}
+
+	var req models.UpdateStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.AuthError{
+			Error:   "validation_error",
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	user, err := h.accountService.UpdateStatus(c.Request.Context(), c.GetString("user_id"), userID.String(), &req, clientInfo(c))
+	if err != nil {
+		var validationErr *service.StatusValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, models.AuthError{
+				Error:   "validation_error",
+				Message: "Invalid request body: " + validationErr.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrOwnStatus) {
+			c.JSON(http.StatusBadRequest, models.AuthError{
+				Error:   "validation_error",
+				Message: "You cannot change the status of your own account",
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrManagerStatus) {
+			c.JSON(http.StatusForbidden, models.AuthError{
+				Error:   "forbidden",
+				Message: "Users who can manage other users cannot be suspended or banned",
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, models.AuthError{
+				Error:   "not_found",
+				Message: "User not found",
+			})
+			return
+		}
+
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to update user status: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"otp-auth-backend/models"
 	"otp-auth-backend/service"
@@ -10,28 +13,28 @@ import (
 )
 
 type AuthHandler struct {
-	otpService  *service.OTPService
 	authService *service.AuthService
 }
 
-func NewAuthHandler(otpService *service.OTPService, authService *service.AuthService) *AuthHandler {
+func NewAuthHandler(authService *service.AuthService) *AuthHandler {
 	return &AuthHandler{
-		otpService:  otpService,
 		authService: authService,
 	}
 }
 
 // RequestOTP godoc
 // @Summary Request OTP for phone number
-// @Description Generate and send OTP to the specified phone number
+// @Description Generate and send OTP to the specified phone number, given in international format or in the national format of the default region. The response contains the number in E.164. A new code can be requested once resend_available_in seconds have passed. A suspended or banned number gets account_suspended with its status only, without the reason or expiry.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body models.RequestOTPRequest true "Phone number"
 // @Success 200 {object} models.RequestOTPResponse
 // @Failure 400 {object} models.AuthError
+// @Failure 403 {object} models.AccountSuspendedError
 // @Failure 429 {object} models.RateLimitError
 // @Failure 500 {object} models.AuthError
+// @Failure 502 {object} models.AuthError
 // @Router auth/request-otp [post]
 func (h *AuthHandler) RequestOTP(c *gin.Context) {
 	var req models.RequestOTPRequest
@@ -43,18 +46,13 @@ func (h *AuthHandler) RequestOTP(c *gin.Context) {
 		return
 	}
 
-	response, err := h.otpService.RequestOTP(c.Request.Context(), req.Phone)
+	response, err := h.authService.RequestOTP(c.Request.Context(), req.Phone)
 	if err != nil {
-		// Check if it's a rate limit error
-		if rateLimitErr, ok := err.(*service.RateLimitExceededError); ok {
-			c.JSON(http.StatusTooManyRequests, models.RateLimitError{
-				Error:      "rate_limit_exceeded",
-				Message:    "Too many OTP requests. Please try again later.",
-				RetryAfter: int(rateLimitErr.Window.Seconds()),
-			})
+		if writeOTPRequestError(c, err) {
 			return
 		}
 
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, models.AuthError{
 			Error:   "internal_error",
 			Message: "Failed to request OTP: " + err.Error(),
@@ -74,7 +72,9 @@ func (h *AuthHandler) RequestOTP(c *gin.Context) {
 // @Param request body models.VerifyOTPRequest true "Phone number and OTP"
 // @Success 200 {object} models.VerifyOTPResponse
 // @Failure 400 {object} models.AuthError
-// @Failure 401 {object} models.AuthError
+// @Failure 401 {object} models.InvalidOTPError
+// @Failure 403 {object} models.AccountSuspendedError
+// @Failure 429 {object} models.RateLimitError
 // @Failure 500 {object} models.AuthError
 // @Router auth/verify-otp [post]
 func (h *AuthHandler) VerifyOTP(c *gin.Context) {
@@ -87,8 +87,45 @@ func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.VerifyOTP(c.Request.Context(), &req)
+	response, err := h.authService.VerifyOTP(c.Request.Context(), &req, clientInfo(c))
 	if err != nil {
+		var phoneErr *service.InvalidPhoneError
+		if errors.As(err, &phoneErr) {
+			c.JSON(http.StatusBadRequest, invalidPhoneResponse(phoneErr))
+			return
+		}
+
+		var malformedErr *service.MalformedOTPError
+		if errors.As(err, &malformedErr) {
+			c.JSON(http.StatusBadRequest, models.AuthError{
+				Error:   "validation_error",
+				Message: "Invalid OTP: " + malformedErr.Reason,
+			})
+			return
+		}
+
+		var invalidErr *service.InvalidOTPError
+		if errors.As(err, &invalidErr) {
+			c.JSON(http.StatusUnauthorized, models.InvalidOTPError{
+				Error:             "invalid_otp",
+				Message:           "The OTP is incorrect",
+				RemainingAttempts: invalidErr.RemainingAttempts,
+			})
+			return
+		}
+
+		var lockedErr *service.OTPLockedError
+		if errors.As(err, &lockedErr) {
+			c.JSON(http.StatusTooManyRequests, otpLockedResponse(lockedErr))
+			return
+		}
+
+		var suspendedErr *service.AccountSuspendedError
+		if errors.As(err, &suspendedErr) {
+			c.JSON(http.StatusForbidden, accountSuspendedResponse(suspendedErr))
+			return
+		}
+
 		c.JSON(http.StatusUnauthorized, models.AuthError{
 			Error:   "authentication_failed",
 			Message: "OTP verification failed: " + err.Error(),
@@ -98,3 +135,206 @@ func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// writeOTPRequestError responds to the errors of sending a code that are the
+// client's or the provider's fault and reports whether it did
+func writeOTPRequestError(c *gin.Context, err error) bool {
+	var phoneErr *service.InvalidPhoneError
+	if errors.As(err, &phoneErr) {
+		c.JSON(http.StatusBadRequest, invalidPhoneResponse(phoneErr))
+		return true
+	}
+
+	// Check if the phone belongs to a suspended or banned account
+	var suspendedErr *service.AccountSuspendedError
+	if errors.As(err, &suspendedErr) {
+		c.JSON(http.StatusForbidden, accountSuspendedResponse(suspendedErr))
+		return true
+	}
+
+	// Check if the phone is locked out after too many wrong guesses
+	var lockedErr *service.OTPLockedError
+	if errors.As(err, &lockedErr) {
+		c.JSON(http.StatusTooManyRequests, otpLockedResponse(lockedErr))
+		return true
+	}
+
+	// Check if a code was sent too recently
+	var cooldownErr *service.ResendCooldownError
+	if errors.As(err, &cooldownErr) {
+		retryAfter := int(math.Ceil(cooldownErr.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, models.RateLimitError{
+			Error:      "resend_cooldown",
+			Message:    "An OTP was sent recently. Please wait before requesting another one.",
+			RetryAfter: retryAfter,
+		})
+		return true
+	}
+
+	// Check if the phone has received too many codes
+	var sendLimitErr *service.SendLimitError
+	if errors.As(err, &sendLimitErr) {
+		retryAfter := int(math.Ceil(sendLimitErr.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, models.RateLimitError{
+			Error:      "rate_limit_exceeded",
+			Message:    "Too many OTP requests for this phone number. Please try again later.",
+			RetryAfter: retryAfter,
+		})
+		return true
+	}
+
+	// Check if the OTP could not be delivered
+	var deliveryErr *service.DeliveryFailedError
+	if errors.As(err, &deliveryErr) {
+		c.Error(err)
+		c.JSON(http.StatusBadGateway, models.AuthError{
+			Error:   "otp_delivery_failed",
+			Message: "Failed to deliver OTP via " + deliveryErr.Provider + ". Please try again later.",
+		})
+		return true
+	}
+
+	return false
+}
+
+func clientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+func invalidPhoneResponse(err *service.InvalidPhoneError) models.AuthError {
+	return models.AuthError{
+		Error:   "invalid_phone",
+		Message: "Invalid phone number: " + err.Reason,
+	}
+}
+
+func accountSuspendedResponse(err *service.AccountSuspendedError) models.AccountSuspendedError {
+	return models.NewAccountSuspendedError(err.Status, err.Reason, err.ExpiresAt)
+}
+
+func otpLockedResponse(err *service.OTPLockedError) models.RateLimitError {
+	return models.RateLimitError{
+		Error:      "otp_locked",
+		Message:    "Too many failed OTP attempts. Please try again later.",
+		RetryAfter: int(err.RetryAfter.Seconds()),
+	}
+}
+
+// RefreshToken godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access and refresh token pair. Refresh tokens are single use; replaying a rotated token revokes the whole session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.AuthError
+// @Failure 401 {object} models.AuthError
+// @Failure 403 {object} models.AccountSuspendedError
+// @Failure 500 {object} models.AuthError
+// @Router auth/refresh [post]
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.AuthError{
+			Error:   "validation_error",
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	response, err := h.authService.RefreshTokens(c.Request.Context(), req.RefreshToken, clientInfo(c))
+	if err != nil {
+		var suspendedErr *service.AccountSuspendedError
+		switch {
+		case errors.As(err, &suspendedErr):
+			c.JSON(http.StatusForbidden, accountSuspendedResponse(suspendedErr))
+		case errors.Is(err, service.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, models.AuthError{
+				Error:   "refresh_token_reused",
+				Message: "Refresh token has already been used; the session has been revoked",
+			})
+		case errors.Is(err, service.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, models.AuthError{
+				Error:   "invalid_refresh_token",
+				Message: "Invalid or expired refresh token",
+			})
+		default:
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, models.AuthError{
+				Error:   "internal_error",
+				Message: "Failed to refresh token: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout godoc
+// @Summary Log out the current session
+// @Description Revoke the presented access token and the refresh tokens of its session
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.MessageResponse
+// @Failure 401 {object} models.AuthError
+// @Failure 500 {object} models.AuthError
+// @Router auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+
+	if err := h.authService.Logout(c.Request.Context(), claims); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to log out: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Logged out successfully"})
+}
+
+// LogoutAll godoc
+// @Summary Log out all sessions
+// @Description Revoke every access and refresh token issued to the current user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.MessageResponse
+// @Failure 401 {object} models.AuthError
+// @Failure 500 {object} models.AuthError
+// @Router auth/logout-all [post]
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	if err := h.authService.LogoutAll(c.Request.Context(), userID); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to log out: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Logged out of all sessions successfully"})
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens, identified by kid. Empty when tokens are signed with a shared secret.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.JWKSResponse
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.authService.JWKS())
+}
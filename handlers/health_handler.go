@@ -3,71 +3,155 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"net/http"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"otp-auth-backend/config"
+	"otp-auth-backend/logging"
+
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 )
 
+// Health states, from best to worst
+const (
+	healthStatusHealthy   = "healthy"
+	healthStatusDegraded  = "degraded"
+	healthStatusUnhealthy = "unhealthy"
+)
+
 // HealthHandler manages health check endpoints
 type HealthHandler struct {
-	db    *sql.DB
-	redis *redis.Client
+	db           *sql.DB
+	redis        *redis.Client
+	config       *config.HealthConfig
+	shuttingDown atomic.Bool
 }
 
 // NewHealthHandler creates a new health handler instance
-func NewHealthHandler(db *sql.DB, redis *redis.Client) *HealthHandler {
-	return &HealthHandler{db: db, redis: redis}
+func NewHealthHandler(db *sql.DB, redis *redis.Client, config *config.HealthConfig) *HealthHandler {
+	return &HealthHandler{db: db, redis: redis, config: config}
 }
 
-// HealthCheck provides comprehensive health status
-func (h *HealthHandler) HealthCheck(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
-	defer cancel()
+// SetShuttingDown makes readiness fail so load balancers stop routing new
+// requests here while in-flight requests drain
+func (h *HealthHandler) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
 
-	health := gin.H{
-		"status":    "healthy",
-		"timestamp": time.Now().Format(time.RFC3339),
-		"version":   "1.0.0",
-		"uptime":    time.Since(startTime).String(),
-		"services":  make(map[string]gin.H),
-		"system":    getSystemInfo(),
+// Liveness reports whether the process is running. It does not check
+// dependencies, so an outage of Postgres or Redis does not restart the pod.
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness reports whether this instance should receive traffic. A degraded
+// dependency still counts as ready.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	if h.shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
 	}
 
-	// Check database health
-	dbHealth := h.checkDatabaseHealth(ctx)
-	health["services"].(map[string]gin.H)["database"] = dbHealth
-	if dbHealth["status"] == "unhealthy" {
-		health["status"] = "unhealthy"
+	status, services := h.checkServices(c.Request.Context())
+
+	checks := make(gin.H, len(services))
+	for name, service := range services {
+		checks[name] = service["status"]
 	}
 
-	// Check Redis health
-	redisHealth := h.checkRedisHealth(ctx)
-	health["services"].(map[string]gin.H)["redis"] = redisHealth
-	if redisHealth["status"] == "unhealthy" {
-		health["status"] = "unhealthy"
+	statusCode := http.StatusOK
+	if status == healthStatusUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	c.JSON(statusCode, gin.H{"status": status, "checks": checks})
+}
+
+// HealthCheck provides comprehensive health status
+func (h *HealthHandler) HealthCheck(c *gin.Context) {
+	status, services := h.checkServices(c.Request.Context())
+	if h.shuttingDown.Load() {
+		status = healthStatusUnhealthy
+	}
+
+	health := gin.H{
+		"status":        status,
+		"timestamp":     time.Now().Format(time.RFC3339),
+		"version":       "1.0.0",
+		"uptime":        time.Since(startTime).String(),
+		"shutting_down": h.shuttingDown.Load(),
+		"services":      services,
+		"system":        getSystemInfo(),
 	}
 
 	// Determine HTTP status code
 	statusCode := http.StatusOK
-	if health["status"] == "unhealthy" {
+	if status == healthStatusUnhealthy {
 		statusCode = http.StatusServiceUnavailable
 	}
 
 	c.JSON(statusCode, health)
 }
 
+// checkServices runs the dependency checks concurrently, each with its own
+// timeout, and returns the overall status with the per-service results
+func (h *HealthHandler) checkServices(ctx context.Context) (string, map[string]gin.H) {
+	checks := map[string]func(context.Context) gin.H{
+		"database": h.checkDatabaseHealth,
+		"redis":    h.checkRedisHealth,
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	services := make(map[string]gin.H, len(checks))
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) gin.H) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, h.config.CheckTimeout)
+			defer cancel()
+
+			result := check(checkCtx)
+
+			mu.Lock()
+			services[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	status := healthStatusHealthy
+	for _, service := range services {
+		switch service["status"] {
+		case healthStatusUnhealthy:
+			status = healthStatusUnhealthy
+		case healthStatusDegraded:
+			if status == healthStatusHealthy {
+				status = healthStatusDegraded
+			}
+		}
+	}
+
+	return status, services
+}
+
 // checkDatabaseHealth checks the database connection and performance
 func (h *HealthHandler) checkDatabaseHealth(ctx context.Context) gin.H {
 	start := time.Now()
 
 	// Test connection
 	if err := h.db.PingContext(ctx); err != nil {
+		logging.FromContext(ctx).Error("Health check: database unavailable", "error", err)
 		return gin.H{
-			"status":  "unhealthy",
-			"error":   err.Error(),
+			"status":  healthStatusUnhealthy,
+			"error":   checkError(err),
 			"latency": time.Since(start).String(),
 		}
 	}
@@ -76,7 +160,7 @@ func (h *HealthHandler) checkDatabaseHealth(ctx context.Context) gin.H {
 	stats := h.db.Stats()
 
 	return gin.H{
-		"status":     "healthy",
+		"status":     healthStatusHealthy,
 		"latency":    time.Since(start).String(),
 		"open_conns": stats.OpenConnections,
 		"in_use":     stats.InUse,
@@ -85,31 +169,45 @@ func (h *HealthHandler) checkDatabaseHealth(ctx context.Context) gin.H {
 	}
 }
 
-// checkRedisHealth checks the Redis connection and performance
+// checkRedisHealth checks the Redis connection and performance. Redis that
+// answers slower than the configured threshold is reported as degraded.
 func (h *HealthHandler) checkRedisHealth(ctx context.Context) gin.H {
 	start := time.Now()
 
 	// Test connection
 	if err := h.redis.Ping(ctx).Err(); err != nil {
+		logging.FromContext(ctx).Error("Health check: Redis unavailable", "error", err)
 		return gin.H{
-			"status":  "unhealthy",
-			"error":   err.Error(),
+			"status":  healthStatusUnhealthy,
+			"error":   checkError(err),
 			"latency": time.Since(start).String(),
 		}
 	}
+	latency := time.Since(start)
 
-	// Get Redis info
-	info, err := h.redis.Info(ctx, "server").Result()
-	redisInfo := "unknown"
-	if err == nil {
-		redisInfo = info
+	status := healthStatusHealthy
+	if h.config.RedisDegradedLatency > 0 && latency > h.config.RedisDegradedLatency {
+		status = healthStatusDegraded
 	}
 
+	stats := h.redis.PoolStats()
+
 	return gin.H{
-		"status":  "healthy",
-		"latency": time.Since(start).String(),
-		"info":    redisInfo,
+		"status":      status,
+		"latency":     latency.String(),
+		"total_conns": stats.TotalConns,
+		"idle_conns":  stats.IdleConns,
+		"timeouts":    stats.Timeouts,
+	}
+}
+
+// checkError describes a failed check without exposing hosts or credentials
+// to unauthenticated callers; the full error is logged instead
+func checkError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
 	}
+	return "unavailable"
 }
 
 // getSystemInfo returns system resource information
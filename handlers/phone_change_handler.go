@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"otp-auth-backend/models"
+	"otp-auth-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestPhoneChange godoc
+// @Summary Start changing the phone number
+// @Description Send a confirmation code to the new phone number. If the server requires it, a second code is sent to the current number. Both are confirmed with me/phone/verify.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.ChangePhoneRequest true "New phone number"
+// @Security BearerAuth
+// @Success 200 {object} models.ChangePhoneResponse
+// @Failure 400 {object} models.AuthError
+// @Failure 401 {object} models.AuthError
+// @Failure 404 {object} models.AuthError
+// @Failure 409 {object} models.AuthError
+// @Failure 429 {object} models.RateLimitError
+// @Failure 500 {object} models.AuthError
+// @Failure 502 {object} models.AuthError
+// @Router me/phone [post]
+func (h *AuthHandler) RequestPhoneChange(c *gin.Context) {
+	var req models.ChangePhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.AuthError{
+			Error:   "validation_error",
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	response, err := h.authService.RequestPhoneChange(c.Request.Context(), c.GetString("user_id"), req.Phone)
+	if err != nil {
+		if writePhoneChangeError(c, err) || writeOTPRequestError(c, err) {
+			return
+		}
+
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to request phone change: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// VerifyPhoneChange godoc
+// @Summary Confirm the new phone number
+// @Description Verify the code sent to the new number (and old_otp, the code sent to the current number, if required) and change the phone number. All existing sessions are revoked and a new token pair is returned.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyPhoneChangeRequest true "New phone number and codes"
+// @Security BearerAuth
+// @Success 200 {object} models.VerifyOTPResponse
+// @Failure 400 {object} models.AuthError
+// @Failure 401 {object} models.InvalidOTPError
+// @Failure 404 {object} models.AuthError
+// @Failure 409 {object} models.AuthError
+// @Failure 429 {object} models.RateLimitError
+// @Failure 500 {object} models.AuthError
+// @Router me/phone/verify [post]
+func (h *AuthHandler) VerifyPhoneChange(c *gin.Context) {
+	var req models.VerifyPhoneChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.AuthError{
+			Error:   "validation_error",
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	response, err := h.authService.ConfirmPhoneChange(c.Request.Context(), c.GetString("user_id"), &req, clientInfo(c))
+	if err != nil {
+		if writePhoneChangeError(c, err) {
+			return
+		}
+
+		var phoneErr *service.InvalidPhoneError
+		if errors.As(err, &phoneErr) {
+			c.JSON(http.StatusBadRequest, invalidPhoneResponse(phoneErr))
+			return
+		}
+
+		var malformedErr *service.MalformedOTPError
+		if errors.As(err, &malformedErr) {
+			c.JSON(http.StatusBadRequest, models.AuthError{
+				Error:   "validation_error",
+				Message: "Invalid OTP: " + malformedErr.Reason,
+			})
+			return
+		}
+
+		// Tell the client which of the two codes was wrong
+		errorCode, message := "invalid_otp", "The OTP is incorrect"
+		var oldPhoneErr *service.OldPhoneOTPError
+		if errors.As(err, &oldPhoneErr) {
+			errorCode, message = "invalid_old_otp", "The OTP sent to the current phone number is incorrect"
+		}
+
+		var invalidErr *service.InvalidOTPError
+		if errors.As(err, &invalidErr) {
+			c.JSON(http.StatusUnauthorized, models.InvalidOTPError{
+				Error:             errorCode,
+				Message:           message,
+				RemainingAttempts: invalidErr.RemainingAttempts,
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrOTPNotFound) {
+			c.JSON(http.StatusUnauthorized, models.AuthError{
+				Error:   errorCode,
+				Message: "The OTP has expired or was not requested",
+			})
+			return
+		}
+
+		var lockedErr *service.OTPLockedError
+		if errors.As(err, &lockedErr) {
+			c.JSON(http.StatusTooManyRequests, otpLockedResponse(lockedErr))
+			return
+		}
+
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to change phone number: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// writePhoneChangeError responds to the errors specific to changing the phone
+// and reports whether it did
+func writePhoneChangeError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrPhoneUnchanged):
+		c.JSON(http.StatusBadRequest, models.AuthError{
+			Error:   "phone_unchanged",
+			Message: "The new phone number is the current one",
+		})
+	case errors.Is(err, service.ErrPhoneInUse):
+		c.JSON(http.StatusConflict, models.AuthError{
+			Error:   "phone_in_use",
+			Message: "The phone number is already registered to another account",
+		})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, models.AuthError{
+			Error:   "not_found",
+			Message: "User not found",
+		})
+	default:
+		return false
+	}
+	return true
+}
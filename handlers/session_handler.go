@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"otp-auth-backend/models"
+	"otp-auth-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type SessionHandler struct {
+	sessionService *service.SessionService
+}
+
+func NewSessionHandler(sessionService *service.SessionService) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+	}
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List the current user's active sessions, flagging the one used for this request
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SessionListResponse
+// @Failure 401 {object} models.AuthError
+// @Failure 500 {object} models.AuthError
+// @Router me/sessions [get]
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+
+	sessions, err := h.sessionService.ListSessions(c.Request.Context(), claims.Subject, claims.SessionID)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to list sessions: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Log out one of the current user's sessions and invalidate its tokens
+// @Tags sessions
+// @Produce json
+// @Param id path string true "Session ID"
+// @Security BearerAuth
+// @Success 200 {object} models.MessageResponse
+// @Failure 400 {object} models.AuthError
+// @Failure 401 {object} models.AuthError
+// @Failure 404 {object} models.AuthError
+// @Failure 500 {object} models.AuthError
+// @Router me/sessions/{id} [delete]
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, models.AuthError{
+			Error:   "validation_error",
+			Message: "Session ID must be a valid UUID",
+		})
+		return
+	}
+
+	err := h.sessionService.RevokeSession(c.Request.Context(), c.GetString("user_id"), sessionID)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, models.AuthError{
+				Error:   "not_found",
+				Message: "Session not found",
+			})
+			return
+		}
+
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to revoke session: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Session revoked successfully"})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"otp-auth-backend/models"
@@ -21,7 +22,7 @@ func NewUserHandler(userService *service.UserService) *UserHandler {
 
 // GetUserByID godoc
 // @Summary Get user by ID
-// @Description Retrieve a single user by their ID
+// @Description Retrieve a single user by their ID. Regular users can only read their own record.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -30,6 +31,7 @@ func NewUserHandler(userService *service.UserService) *UserHandler {
 // @Success 200 {object} models.UserResponse
 // @Failure 400 {object} models.AuthError
 // @Failure 401 {object} models.AuthError
+// @Failure 403 {object} models.AuthError
 // @Failure 404 {object} models.AuthError
 // @Failure 500 {object} models.AuthError
 // @Router users/{id} [get]
@@ -43,9 +45,19 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		return
 	}
 
+	// Reading someone else's record needs the users:read permission
+	claims := c.MustGet("claims").(*service.Claims)
+	if userID != claims.Subject && !claims.Role.Can(models.PermissionReadUsers) {
+		c.JSON(http.StatusForbidden, models.AuthError{
+			Error:   "forbidden",
+			Message: "You do not have permission to access this resource",
+		})
+		return
+	}
+
 	user, err := h.userService.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
-		if err.Error() == "user not found" {
+		if errors.Is(err, service.ErrUserNotFound) {
 			c.JSON(http.StatusNotFound, models.AuthError{
 				Error:   "not_found",
 				Message: "User not found",
@@ -53,6 +65,7 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 			return
 		}
 
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, models.AuthError{
 			Error:   "internal_error",
 			Message: "Failed to get user: " + err.Error(),
@@ -65,7 +78,7 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 
 // ListUsers godoc
 // @Summary List users with pagination and search
-// @Description Get a paginated list of users with optional search and sorting
+// @Description Get a paginated list of users with optional search and sorting. Requires the support or admin role.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -77,6 +90,7 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 // @Success 200 {object} models.UserListResponse
 // @Failure 400 {object} models.AuthError
 // @Failure 401 {object} models.AuthError
+// @Failure 403 {object} models.AuthError
 // @Failure 500 {object} models.AuthError
 // @Router users [get]
 func (h *UserHandler) ListUsers(c *gin.Context) {
@@ -91,6 +105,7 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 
 	users, err := h.userService.ListUsers(c.Request.Context(), &query)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, models.AuthError{
 			Error:   "internal_error",
 			Message: "Failed to list users: " + err.Error(),
@@ -100,3 +115,90 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 
 	c.JSON(http.StatusOK, users)
 }
+
+// GetMe godoc
+// @Summary Get the current user
+// @Description Retrieve the profile of the authenticated user
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.UserResponse
+// @Failure 401 {object} models.AuthError
+// @Failure 404 {object} models.AuthError
+// @Failure 500 {object} models.AuthError
+// @Router me [get]
+func (h *UserHandler) GetMe(c *gin.Context) {
+	user, err := h.userService.GetUserByID(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, models.AuthError{
+				Error:   "not_found",
+				Message: "User not found",
+			})
+			return
+		}
+
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to get user: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateMe godoc
+// @Summary Update the current user's profile
+// @Description Change display name, email, locale (BCP 47), time zone (IANA) or avatar URL (https). Omitted fields are left unchanged; an empty string clears a field.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.UpdateProfileRequest true "Profile fields to change"
+// @Security BearerAuth
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} models.AuthError
+// @Failure 401 {object} models.AuthError
+// @Failure 404 {object} models.AuthError
+// @Failure 500 {object} models.AuthError
+// @Router me [patch]
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.AuthError{
+			Error:   "validation_error",
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(c.Request.Context(), c.GetString("user_id"), &req, clientInfo(c))
+	if err != nil {
+		var validationErr *service.ProfileValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, models.AuthError{
+				Error:   "validation_error",
+				Message: "Invalid request body: " + validationErr.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, models.AuthError{
+				Error:   "not_found",
+				Message: "User not found",
+			})
+			return
+		}
+
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, models.AuthError{
+			Error:   "internal_error",
+			Message: "Failed to update profile: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"otp-auth-backend/models"
+	"otp-auth-backend/service"
+	"otp-auth-backend/store"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestGetUserByIDOwnerCheck(t *testing.T) {
+	self, other := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name   string
+		role   models.Role
+		target uuid.UUID
+		want   int
+	}{
+		{"user reads own record", models.RoleUser, self, http.StatusOK},
+		{"user reads another record", models.RoleUser, other, http.StatusForbidden},
+		{"support reads another record", models.RoleSupport, other, http.StatusOK},
+		{"admin reads another record", models.RoleAdmin, other, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			db := &store.Database{DB: sqlDB}
+
+			// A forbidden request must not reach the database
+			if tt.want == http.StatusOK {
+				now := time.Now()
+				mock.ExpectQuery("FROM users").WithArgs(tt.target.String()).WillReturnRows(
+					sqlmock.NewRows([]string{"id", "phone", "role", "display_name", "email", "locale", "timezone",
+						"avatar_url", "status", "status_reason", "status_expires_at", "registered_at", "created_at", "updated_at"}).
+						AddRow(tt.target, "+12015550123", "user", "", "", "", "", "", "active", "", nil, now, now, now))
+			}
+
+			gin.SetMode(gin.TestMode)
+			handler := NewUserHandler(service.NewUserService(store.NewUserRepository(db), store.NewAuditRepository(db)))
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("claims", &service.Claims{
+					Role:             tt.role,
+					RegisteredClaims: jwt.RegisteredClaims{Subject: self.String()},
+				})
+			})
+			router.GET("/users/:id", handler.GetUserByID)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/"+tt.target.String(), nil))
+
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys are attribute keys whose values are never logged
+var secretKeys = map[string]bool{
+	"otp":           true,
+	"code":          true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+	"pepper":        true,
+}
+
+var (
+	// phonePattern matches international numbers embedded in free text
+	phonePattern = regexp.MustCompile(`\+\d{7,15}`)
+	// jwtPattern matches compact JWS tokens
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// Redact is a slog ReplaceAttr function. Secret attributes are dropped, phone
+// attributes are masked and phone numbers or JWTs inside any other string,
+// including the message and error texts, are masked as well.
+func Redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+
+	if secretKeys[key] {
+		return slog.String(a.Key, redacted)
+	}
+
+	if key == "phone" {
+		return slog.String(a.Key, MaskPhone(a.Value.String()))
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Scrub(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Scrub(err.Error()))
+		}
+	}
+
+	return a
+}
+
+// Scrub masks phone numbers and JWTs found in free text
+func Scrub(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	return phonePattern.ReplaceAllStringFunc(s, MaskPhone)
+}
+
+// MaskPhone keeps only the last two digits of a phone number, which is
+// enough to tell numbers apart when debugging without identifying anyone
+func MaskPhone(phone string) string {
+	prefix := ""
+	if strings.HasPrefix(phone, "+") {
+		prefix, phone = "+", phone[1:]
+	}
+
+	if len(phone) <= 2 {
+		return prefix + strings.Repeat("*", len(phone))
+	}
+
+	return prefix + strings.Repeat("*", len(phone)-2) + phone[len(phone)-2:]
+}
@@ -0,0 +1,127 @@
+// Package metrics defines the Prometheus metrics exported on /metrics
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+const namespace = "otp_auth"
+
+// Registry holds every metric exported by the service. A dedicated registry
+// keeps metrics registered by dependencies out of the output.
+var Registry = prometheus.NewRegistry()
+
+// Outcomes of an OTP verification
+const (
+	VerifyResultVerified = "verified"
+	VerifyResultFailed   = "failed"
+	VerifyResultExpired  = "expired"
+	VerifyResultLocked   = "locked"
+)
+
+// How a user obtained tokens
+const (
+	LoginTypeRegistration = "registration"
+	LoginTypeLogin        = "login"
+)
+
+// How a token pair was issued
+const (
+	GrantOTP     = "otp"
+	GrantRefresh = "refresh"
+)
+
+var (
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	OTPSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "otp",
+		Name:      "sent_total",
+		Help:      "OTPs delivered, by provider and whether an existing code was resent.",
+	}, []string{"provider", "reused"})
+
+	OTPDeliveryFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "otp",
+		Name:      "delivery_failures_total",
+		Help:      "OTPs that the provider failed to deliver.",
+	}, []string{"provider"})
+
+	OTPVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "otp",
+		Name:      "verifications_total",
+		Help:      "OTP verification attempts by result: verified, failed, expired or locked.",
+	}, []string{"result"})
+
+	OTPLockouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "otp",
+		Name:      "lockouts_total",
+		Help:      "Phones locked out after burning a code with wrong guesses.",
+	})
+
+	TokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "tokens_issued_total",
+		Help:      "Access and refresh token pairs issued, by grant.",
+	}, []string{"grant"})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "Successful OTP logins, split into new registrations and returning users.",
+	}, []string{"type"})
+
+	RateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rate_limit",
+		Name:      "rejections_total",
+		Help:      "Requests rejected by a rate limit policy.",
+	}, []string{"policy"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		OTPSent,
+		OTPDeliveryFailures,
+		OTPVerifications,
+		OTPLockouts,
+		TokensIssued,
+		Logins,
+		RateLimitRejections,
+	)
+}
+
+// RegisterDatabase exports the connection pool stats of db
+func RegisterDatabase(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterRedis exports the connection pool stats of client
+func RegisterRedis(client *redis.Client) {
+	Registry.MustRegister(newRedisPoolCollector(client))
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
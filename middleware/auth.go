@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -44,7 +45,21 @@ func AuthMiddleware(authService *service.AuthService) gin.HandlerFunc {
 		}
 
 		// Validate the token
-		userID, err := authService.ValidateJWT(token)
+		claims, err := authService.ValidateJWT(c.Request.Context(), token)
+		var suspendedErr *service.AccountSuspendedError
+		if errors.As(err, &suspendedErr) {
+			c.JSON(http.StatusForbidden, models.NewAccountSuspendedError(suspendedErr.Status, suspendedErr.Reason, suspendedErr.ExpiresAt))
+			c.Abort()
+			return
+		}
+		if errors.Is(err, service.ErrTokenRevoked) {
+			c.JSON(http.StatusUnauthorized, models.AuthError{
+				Error:   "token_revoked",
+				Message: "Token has been revoked",
+			})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.AuthError{
 				Error:   "invalid_token",
@@ -54,8 +69,9 @@ func AuthMiddleware(authService *service.AuthService) gin.HandlerFunc {
 			return
 		}
 
-		// Set user ID in context for later use
-		c.Set("user_id", userID)
+		// Set user ID and claims in context for later use
+		c.Set("user_id", claims.Subject)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
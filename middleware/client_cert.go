@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"otp-auth-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireClientCert only lets through requests that presented a client
+// certificate verified against TLS_CLIENT_CA_FILE. It is meant for internal
+// routes when TLS_CLIENT_AUTH is verify_if_given, so public clients can still
+// reach the rest of the API without a certificate.
+func RequireClientCert() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			c.JSON(http.StatusForbidden, models.AuthError{
+				Error:   "client_certificate_required",
+				Message: "A verified client certificate is required",
+			})
+			c.Abort()
+			return
+		}
+
+		// Expose the caller identity to handlers and logs
+		c.Set("client_cert_subject", c.Request.TLS.VerifiedChains[0][0].Subject.CommonName)
+		c.Next()
+	})
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"otp-auth-backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	corsAllowMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowHeaders = "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Requested-With, X-Request-ID, traceparent, tracestate"
+)
+
+// originPattern is a compiled ALLOWED_ORIGINS entry. Subdomain patterns
+// such as https://*.example.com match any subdomain but not the apex domain.
+type originPattern struct {
+	scheme    string
+	host      string
+	port      string
+	subdomain bool
+}
+
+// originList is the set of origins allowed for a group of routes
+type originList struct {
+	any      bool
+	patterns []originPattern
+}
+
+type corsRoute struct {
+	prefix  string
+	origins originList
+}
+
+// corsPolicy resolves the allowed origins for a request path
+type corsPolicy struct {
+	defaults       originList
+	routes         []corsRoute
+	exposedHeaders string
+	maxAge         string
+}
+
+func newCORSPolicy(cfg *config.SecurityConfig) *corsPolicy {
+	policy := &corsPolicy{
+		defaults:       compileOrigins(cfg.AllowedOrigins),
+		exposedHeaders: strings.Join(cfg.CORSExposedHeaders, ", "),
+		maxAge:         strconv.Itoa(int(cfg.CORSMaxAge.Seconds())),
+	}
+
+	for _, override := range cfg.CORSRouteOverrides {
+		policy.routes = append(policy.routes, corsRoute{
+			prefix:  override.PathPrefix,
+			origins: compileOrigins(override.Origins),
+		})
+	}
+
+	// Check the most specific prefix first
+	sort.SliceStable(policy.routes, func(i, j int) bool {
+		return len(policy.routes[i].prefix) > len(policy.routes[j].prefix)
+	})
+
+	return policy
+}
+
+func compileOrigins(origins []string) originList {
+	var list originList
+	for _, origin := range origins {
+		if origin == "*" {
+			list.any = true
+			continue
+		}
+
+		// Patterns are checked by config.Validate; skip anything unparsable
+		u, err := url.Parse(origin)
+		if err != nil {
+			continue
+		}
+
+		host := strings.ToLower(u.Hostname())
+		pattern := originPattern{scheme: u.Scheme, host: host, port: u.Port()}
+		if strings.HasPrefix(host, "*.") {
+			pattern.host = host[1:]
+			pattern.subdomain = true
+		}
+		list.patterns = append(list.patterns, pattern)
+	}
+	return list
+}
+
+// originsFor returns the origin list that applies to a request path
+func (p *corsPolicy) originsFor(path string) originList {
+	for _, route := range p.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			return route.origins
+		}
+	}
+	return p.defaults
+}
+
+func (l originList) allows(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range l.patterns {
+		if pattern.scheme != u.Scheme || pattern.port != u.Port() {
+			continue
+		}
+		if pattern.subdomain {
+			if strings.HasSuffix(host, pattern.host) && len(host) > len(pattern.host) {
+				return true
+			}
+		} else if pattern.host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the CORS response headers for allowed origins
+func (p *corsPolicy) apply(c *gin.Context, preflight bool) {
+	origins := p.originsFor(c.Request.URL.Path)
+
+	// The response always depends on Origin, if only on whether it was sent,
+	// so caches must never reuse it for another origin
+	c.Writer.Header().Add("Vary", "Origin")
+	if preflight {
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	origin := c.Request.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+
+	switch {
+	case origins.allows(origin):
+		// Only explicitly listed origins may send credentials
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Allow-Credentials", "true")
+	case origins.any:
+		c.Header("Access-Control-Allow-Origin", "*")
+	default:
+		return
+	}
+
+	if preflight {
+		c.Header("Access-Control-Allow-Methods", corsAllowMethods)
+		c.Header("Access-Control-Allow-Headers", corsAllowHeaders)
+		c.Header("Access-Control-Max-Age", p.maxAge)
+	} else if p.exposedHeaders != "" {
+		c.Header("Access-Control-Expose-Headers", p.exposedHeaders)
+	}
+}
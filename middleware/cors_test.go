@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"otp-auth-backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOriginListAllows(t *testing.T) {
+	origins := compileOrigins([]string{"https://*.example.com", "https://app.test", "http://localhost:3000"})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://api.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"https://evil-example.com", false},
+		{"https://example.com.evil.test", false},
+		{"https://api.example.com.evil.test", false},
+		{"http://api.example.com", false},
+		{"https://api.example.com:8443", false},
+		{"https://APP.test", true},
+		{"https://app.test", true},
+		{"https://sub.app.test", false},
+		{"http://localhost:3000", true},
+		{"http://localhost:3001", false},
+		{"null", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := origins.allows(tt.origin); got != tt.want {
+				t.Errorf("allows(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func newCORSRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Security: config.SecurityConfig{
+		EnableCORS:         true,
+		AllowedOrigins:     []string{"https://*.example.com"},
+		CORSExposedHeaders: []string{"X-Request-ID", "Retry-After"},
+		CORSMaxAge:         10 * time.Minute,
+		CORSRouteOverrides: []config.CORSRouteOverride{
+			{PathPrefix: "/.well-known/", Origins: []string{"*"}},
+		},
+		HSTSMaxAge: time.Hour,
+	}}
+
+	router := gin.New()
+	router.Use(SecurityMiddleware(cfg))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/v1/me", ok)
+	router.GET("/.well-known/jwks.json", ok)
+	return router
+}
+
+func TestSecurityMiddlewareCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantOrigin  string
+		wantCreds   bool
+		wantExposed string
+		wantMaxAge  string
+	}{
+		{
+			name: "allowed origin", method: http.MethodGet, path: "/api/v1/me", origin: "https://app.example.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://app.example.com", wantCreds: true,
+			wantExposed: "X-Request-ID, Retry-After",
+		},
+		{
+			name: "apex domain is not a subdomain", method: http.MethodGet, path: "/api/v1/me", origin: "https://example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "lookalike domain", method: http.MethodGet, path: "/api/v1/me", origin: "https://evil-example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "no origin", method: http.MethodGet, path: "/api/v1/me",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "allowed preflight", method: http.MethodOptions, path: "/api/v1/me", origin: "https://app.example.com", preflight: true,
+			wantStatus: http.StatusNoContent, wantOrigin: "https://app.example.com", wantCreds: true, wantMaxAge: "600",
+		},
+		{
+			name: "rejected preflight", method: http.MethodOptions, path: "/api/v1/me", origin: "https://evil-example.com", preflight: true,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "route open to every origin", method: http.MethodGet, path: "/.well-known/jwks.json", origin: "https://other.test",
+			wantStatus: http.StatusOK, wantOrigin: "*", wantExposed: "X-Request-ID, Retry-After",
+		},
+		{
+			name: "route open to every origin without origin", method: http.MethodGet, path: "/.well-known/jwks.json",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	router := newCORSRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			header := w.Header()
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := header.Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.wantCreds)
+			}
+			if got := header.Get("Access-Control-Expose-Headers"); got != tt.wantExposed {
+				t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, tt.wantExposed)
+			}
+			if got := header.Get("Access-Control-Max-Age"); got != tt.wantMaxAge {
+				t.Errorf("Access-Control-Max-Age = %q, want %q", got, tt.wantMaxAge)
+			}
+
+			vary := strings.Join(header.Values("Vary"), ", ")
+			if !strings.Contains(vary, "Origin") {
+				t.Errorf("Vary = %q, want it to contain Origin", vary)
+			}
+			if tt.preflight && !strings.Contains(vary, "Access-Control-Request-Method") {
+				t.Errorf("Vary = %q, want it to contain Access-Control-Request-Method", vary)
+			}
+			if tt.preflight && tt.wantOrigin != "" && !strings.Contains(header.Get("Access-Control-Allow-Methods"), http.MethodPatch) {
+				t.Errorf("Access-Control-Allow-Methods = %q, want it to contain PATCH", header.Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"otp-auth-backend/logging"
+	"otp-auth-backend/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestLogger stores a logger tagged with the request and trace IDs in the
+// request context for services to use and writes one access log line per
+// request. It runs after RequestIDMiddleware and TracingMiddleware.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		start := time.Now()
+
+		requestLogger := logger.With("request_id", c.GetString("request_id"))
+		if traceID := tracing.TraceID(c.Request.Context()); traceID != "" {
+			requestLogger = requestLogger.With("trace_id", traceID)
+		}
+		c.Request = c.Request.WithContext(logging.WithContext(c.Request.Context(), requestLogger))
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"route", route,
+			"status", c.Writer.Status(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		}
+		if userID := c.GetString("user_id"); userID != "" {
+			attrs = append(attrs, "user_id", userID)
+		}
+		if len(c.Errors) > 0 {
+			// Handlers attach the cause of 5xx responses with c.Error
+			attrs = append(attrs, "errors", strings.Join(c.Errors.Errors(), "; "))
+		}
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		requestLogger.Log(c.Request.Context(), level, "HTTP request", attrs...)
+	})
+}
+
+// RecoveryMiddleware logs panics through the structured logger instead of
+// gin's plain text request dump and answers 500
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logging.FromContext(c.Request.Context()).Error("Panic while handling request",
+			"panic", fmt.Sprint(recovered),
+			"stack", string(debug.Stack()),
+		)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"otp-auth-backend/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsMethods are the methods recorded by name; any other verb a client
+// sends is recorded as OTHER so it cannot create new series
+var metricsMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// MetricsMiddleware records the latency of every request by route template,
+// so path parameters such as user IDs do not create new series
+func MetricsMiddleware() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		method := c.Request.Method
+		if !metricsMethods[method] {
+			method = "OTHER"
+		}
+
+		metrics.HTTPRequestDuration.
+			WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	})
+}
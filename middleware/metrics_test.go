@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"otp-auth-backend/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsMiddlewareBoundsMethods(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metrics.HTTPRequestDuration.Reset()
+
+	router := gin.New()
+	router.Use(MetricsMiddleware())
+	router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, method := range []string{"FOO", "BAR", "PROPFIND", "get"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/missing", nil))
+	}
+	if n := testutil.CollectAndCount(metrics.HTTPRequestDuration); n != 1 {
+		t.Errorf("non-standard methods created %d series, want 1", n)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if n := testutil.CollectAndCount(metrics.HTTPRequestDuration); n != 2 {
+		t.Errorf("got %d series after a GET, want 2", n)
+	}
+}
@@ -1,98 +1,200 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"otp-auth-backend/config"
+	"otp-auth-backend/logging"
+	"otp-auth-backend/metrics"
+	"otp-auth-backend/models"
+	"otp-auth-backend/phone"
+	"otp-auth-backend/store"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
 )
 
-// RateLimiter manages rate limiting for different clients
-type RateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-	rate     rate.Limit
-	burst    int
+// rateLimitExemptPaths are never rate limited so that probes keep working
+var rateLimitExemptPaths = map[string]bool{
+	"/health":  true,
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
 }
 
-// NewRateLimiter creates a new rate limiter instance
-func NewRateLimiter(r rate.Limit, burst int) *RateLimiter {
-	return &RateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-		rate:     r,
-		burst:    burst,
-	}
-}
-
-// getLimiter returns or creates a rate limiter for a specific key
-func (rl *RateLimiter) getLimiter(key string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	limiter, exists := rl.limiters[key]
-	if !exists {
-		limiter = rate.NewLimiter(rl.rate, rl.burst)
-		rl.limiters[key] = limiter
-	}
-
-	return limiter
-}
+// appliedPoliciesKey stores the policies already counted for a request
+const appliedPoliciesKey = "rate_limit_applied_policies"
 
-// cleanup removes old limiters to prevent memory leaks
-func (rl *RateLimiter) cleanup() {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// requestPhoneKey caches the phone parsed from the request body
+const requestPhoneKey = "rate_limit_phone"
 
-	// Simple cleanup - in production you might want more sophisticated cleanup
-	if len(rl.limiters) > 10000 {
-		rl.limiters = make(map[string]*rate.Limiter)
-	}
-}
+// maxPhoneBodySize bounds how much of a request body is read to find the phone
+const maxPhoneBodySize = 64 * 1024
 
-// RateLimitMiddleware provides rate limiting functionality
-func RateLimitMiddleware(config *config.Config) gin.HandlerFunc {
+// RateLimitMiddleware applies every configured rate limit policy matching the
+// request route. The limiter state lives in Redis so that every replica
+// enforces the same budget.
+//
+// Policies whose dimension is not known yet are skipped, so the middleware can
+// be registered globally and again after AuthMiddleware for per-user policies.
+// Each policy is counted at most once per request.
+func RateLimitMiddleware(config *config.Config, redisStore *store.RedisStore) gin.HandlerFunc {
 	if !config.Security.EnableRateLimit {
 		return gin.HandlerFunc(func(c *gin.Context) {
 			c.Next()
 		})
 	}
 
-	// Calculate rate limit from config
-	requestsPerSecond := float64(config.RateLimit.MaxRequests) / config.RateLimit.Window.Seconds()
-	rateLimit := rate.Limit(requestsPerSecond)
-	burst := config.RateLimit.MaxRequests
+	policies := config.RateLimit.Policies
+	phoneRegion := config.Phone.DefaultRegion
 
-	limiter := NewRateLimiter(rateLimit, burst)
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if rateLimitExemptPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
 
-	// Cleanup old limiters periodically
-	go func() {
-		ticker := time.NewTicker(5 * time.Minute)
-		defer ticker.Stop()
-		for range ticker.C {
-			limiter.cleanup()
+		route := c.Request.Method + " " + c.FullPath()
+		applied := appliedPolicies(c)
+
+		var tightest, denied *store.RateLimitResult
+		for _, policy := range policies {
+			if applied[policy.Name] || (policy.Route != "*" && policy.Route != route) {
+				continue
+			}
+
+			key, ok := rateLimitKey(c, policy, phoneRegion)
+			if !ok {
+				continue
+			}
+			applied[policy.Name] = true
+
+			result, err := redisStore.AllowRate(c.Request.Context(), policy.Name+":"+key, policy.Limit, policy.Window)
+			if err != nil {
+				// Fail open: an unavailable limiter should not take the API down with it
+				logging.FromContext(c.Request.Context()).Warn("Rate limiter unavailable", "policy", policy.Name, "error", err)
+				continue
+			}
+
+			if !result.Allowed {
+				metrics.RateLimitRejections.WithLabelValues(policy.Name).Inc()
+				if denied == nil || result.RetryAfter > denied.RetryAfter {
+					denied = result
+				}
+			}
+			if tightest == nil || result.Remaining < tightest.Remaining {
+				tightest = result
+			}
 		}
-	}()
 
-	return gin.HandlerFunc(func(c *gin.Context) {
-		// Use client IP as rate limit key (or user ID if authenticated)
-		key := c.ClientIP()
-
-		if !limiter.getLimiter(key).Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "rate_limit_exceeded",
-				"message":     "Too many requests",
-				"retry_after": time.Now().Add(config.RateLimit.Window).Unix(),
-				"limit":       config.RateLimit.MaxRequests,
-				"window":      config.RateLimit.Window.String(),
+		if denied != nil {
+			setRateLimitHeaders(c, denied)
+
+			retryAfter := ceilSeconds(denied.RetryAfter)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, models.RateLimitError{
+				Error:      "rate_limit_exceeded",
+				Message:    "Too many requests",
+				RetryAfter: retryAfter,
 			})
 			c.Abort()
 			return
 		}
 
+		if tightest != nil {
+			setRateLimitHeaders(c, tightest)
+		}
+
 		c.Next()
 	})
 }
+
+func appliedPolicies(c *gin.Context) map[string]bool {
+	if value, exists := c.Get(appliedPoliciesKey); exists {
+		return value.(map[string]bool)
+	}
+
+	applied := make(map[string]bool)
+	c.Set(appliedPoliciesKey, applied)
+	return applied
+}
+
+// rateLimitKey returns the value a policy is counted by for this request, or
+// false if it is not available
+func rateLimitKey(c *gin.Context, policy config.RateLimitPolicy, phoneRegion string) (string, bool) {
+	switch policy.Dimension {
+	case config.RateLimitDimensionIP:
+		return c.ClientIP(), true
+	case config.RateLimitDimensionGlobal:
+		return "all", true
+	case config.RateLimitDimensionUser:
+		userID := c.GetString("user_id")
+		return userID, userID != ""
+	case config.RateLimitDimensionPhone:
+		number := requestPhone(c, phoneRegion)
+		return number, number != ""
+	case config.RateLimitDimensionPhonePrefix:
+		number := requestPhone(c, phoneRegion)
+		if len(number) > policy.PrefixLength {
+			number = number[:policy.PrefixLength]
+		}
+		return number, number != ""
+	}
+
+	return "", false
+}
+
+// requestPhone extracts the phone field from a JSON request body and restores
+// the body for the handler. Valid numbers are normalized to E.164 so that
+// every way of writing a number shares one bucket; invalid ones are counted
+// as sent, the handler rejects them anyway.
+func requestPhone(c *gin.Context, region string) string {
+	if number, exists := c.Get(requestPhoneKey); exists {
+		return number.(string)
+	}
+
+	number := readRequestPhone(c)
+	if normalized, err := phone.Normalize(number, region); err == nil {
+		number = normalized
+	}
+
+	c.Set(requestPhoneKey, number)
+	return number
+}
+
+func readRequestPhone(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPhoneBodySize))
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+
+	var payload struct {
+		Phone string `json:"phone"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+
+	return payload.Phone
+}
+
+// setRateLimitHeaders sets the RateLimit-* headers from the IETF httpapi draft
+func setRateLimitHeaders(c *gin.Context, result *store.RateLimitResult) {
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+
+	"otp-auth-backend/models"
+	"otp-auth-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets through users whose token carries one of the roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...models.Role) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		role := requestRole(c)
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		forbidden(c)
+	})
+}
+
+// RequirePermission only lets through users whose role grants the
+// permission. It must run after AuthMiddleware.
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if !requestRole(c).Can(permission) {
+			forbidden(c)
+			return
+		}
+
+		c.Next()
+	})
+}
+
+func requestRole(c *gin.Context) models.Role {
+	return c.MustGet("claims").(*service.Claims).Role
+}
+
+func forbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, models.AuthError{
+		Error:   "forbidden",
+		Message: "You do not have permission to access this resource",
+	})
+	c.Abort()
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"otp-auth-backend/models"
+	"otp-auth-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRBACRouter serves /resource behind guard for a caller with role, as
+// AuthMiddleware would leave it
+func newRBACRouter(role models.Role, guard gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("claims", &service.Claims{Role: role})
+	})
+	router.GET("/resource", guard, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		role       models.Role
+		permission models.Permission
+		want       int
+	}{
+		{models.RoleUser, models.PermissionReadUsers, http.StatusForbidden},
+		{models.RoleUser, models.PermissionListUsers, http.StatusForbidden},
+		{models.RoleUser, models.PermissionManageUsers, http.StatusForbidden},
+		{models.RoleSupport, models.PermissionReadUsers, http.StatusOK},
+		{models.RoleSupport, models.PermissionListUsers, http.StatusOK},
+		{models.RoleSupport, models.PermissionManageUsers, http.StatusForbidden},
+		{models.RoleAdmin, models.PermissionReadUsers, http.StatusOK},
+		{models.RoleAdmin, models.PermissionListUsers, http.StatusOK},
+		{models.RoleAdmin, models.PermissionManageUsers, http.StatusOK},
+		{"", models.PermissionReadUsers, http.StatusForbidden},
+		{"superuser", models.PermissionManageUsers, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+" "+string(tt.permission), func(t *testing.T) {
+			router := newRBACRouter(tt.role, RequirePermission(tt.permission))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/resource", nil))
+
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	guard := RequireRole(models.RoleSupport, models.RoleAdmin)
+
+	tests := []struct {
+		role models.Role
+		want int
+	}{
+		{models.RoleUser, http.StatusForbidden},
+		{models.RoleSupport, http.StatusOK},
+		{models.RoleAdmin, http.StatusOK},
+		{"", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			newRBACRouter(tt.role, guard).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/resource", nil))
+
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern bounds inbound IDs so they are safe to log and echo back
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware assigns every request an ID, stored under "request_id"
+// and echoed in X-Request-ID. An inbound X-Request-ID is kept only when the
+// peer is one of trustedProxies, the TRUSTED_PROXIES list also given to the
+// router, so clients cannot inject IDs into our logs.
+func RequestIDMiddleware(trustedProxies []string) gin.HandlerFunc {
+	trusted := trustedPrefixes(trustedProxies)
+
+	return gin.HandlerFunc(func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || !requestIDPattern.MatchString(requestID) || !fromTrustedProxy(c, trusted) {
+			requestID = uuid.New().String()
+		}
+
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	})
+}
+
+// trustedPrefixes parses IPs and CIDRs the way SetTrustedProxies does. The
+// router has already rejected invalid entries at startup, so they are skipped.
+func trustedPrefixes(proxies []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if strings.Contains(proxy, "/") {
+			if prefix, err := netip.ParsePrefix(proxy); err == nil {
+				prefixes = append(prefixes, prefix.Masked())
+			}
+			continue
+		}
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes
+}
+
+// fromTrustedProxy reports whether the direct peer is a trusted proxy, whether
+// or not it also sent X-Forwarded-For
+func fromTrustedProxy(c *gin.Context, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(c.RemoteIP())
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
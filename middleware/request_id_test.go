@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDMiddlewareTrust(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	trustedProxies := []string{"10.0.0.0/8", "192.0.2.10"}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		wantKept     bool
+		wantClientIP string
+	}{
+		{"trusted proxy", "10.0.0.1:4000", "203.0.113.7", true, "203.0.113.7"},
+		{"trusted proxy without X-Forwarded-For", "10.0.0.1:4000", "", true, "10.0.0.1"},
+		{"trusted single IP", "192.0.2.10:4000", "", true, "192.0.2.10"},
+		{"client spoofing X-Forwarded-For", "198.51.100.9:4000", "203.0.113.7", false, "198.51.100.9"},
+		{"client without proxy", "198.51.100.9:4000", "", false, "198.51.100.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			if err := router.SetTrustedProxies(trustedProxies); err != nil {
+				t.Fatalf("SetTrustedProxies: %v", err)
+			}
+
+			var clientIP string
+			router.Use(RequestIDMiddleware(trustedProxies))
+			router.GET("/", func(c *gin.Context) {
+				clientIP = c.ClientIP()
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(RequestIDHeader, "upstream-id")
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if kept := w.Header().Get(RequestIDHeader) == "upstream-id"; kept != tt.wantKept {
+				t.Errorf("request ID kept = %v, want %v", kept, tt.wantKept)
+			}
+			if clientIP != tt.wantClientIP {
+				t.Errorf("client IP = %q, want %q", clientIP, tt.wantClientIP)
+			}
+		})
+	}
+}
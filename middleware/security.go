@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 
 	"otp-auth-backend/config"
@@ -8,19 +9,21 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// SecurityMiddleware provides comprehensive security features
+// SecurityMiddleware applies the CORS policy and sets the security headers
 func SecurityMiddleware(config *config.Config) gin.HandlerFunc {
+	var cors *corsPolicy
+	if config.Security.EnableCORS {
+		cors = newCORSPolicy(&config.Security)
+	}
+
+	hsts := fmt.Sprintf("max-age=%d; includeSubDomains", int(config.Security.HSTSMaxAge.Seconds()))
+
 	return gin.HandlerFunc(func(c *gin.Context) {
-		// CORS with proper origin validation
-		if config.Security.EnableCORS {
-			origin := c.Request.Header.Get("Origin")
-			if isAllowedOrigin(origin, config.Security.AllowedOrigins) {
-				c.Header("Access-Control-Allow-Origin", origin)
-			}
+		preflight := c.Request.Method == http.MethodOptions &&
+			c.Request.Header.Get("Access-Control-Request-Method") != ""
 
-			c.Header("Access-Control-Allow-Credentials", "true")
-			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Requested-With")
+		if cors != nil {
+			cors.apply(c, preflight)
 		}
 
 		// Security headers
@@ -30,9 +33,14 @@ func SecurityMiddleware(config *config.Config) gin.HandlerFunc {
 		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
 		c.Header("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
 
-		// Handle preflight requests
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if config.Security.EnableHTTPS {
+			c.Header("Strict-Transport-Security", hsts)
+		}
+
+		// Answer preflight requests without reaching the handlers; browsers
+		// reject the actual request if no allow headers were set
+		if preflight {
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
@@ -40,20 +48,6 @@ func SecurityMiddleware(config *config.Config) gin.HandlerFunc {
 	})
 }
 
-// isAllowedOrigin checks if the origin is in the allowed list
-func isAllowedOrigin(origin string, allowedOrigins []string) bool {
-	if origin == "" {
-		return false
-	}
-
-	for _, allowed := range allowedOrigins {
-		if allowed == "*" || allowed == origin {
-			return true
-		}
-	}
-	return false
-}
-
 // TrustedProxyMiddleware ensures requests come from trusted sources
 func TrustedProxyMiddleware(config *config.Config) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -0,0 +1,4 @@
+-- Migration: 001_init.down.sql
+-- Description: Drop users table
+
+DROP TABLE IF EXISTS users;
@@ -1,4 +1,4 @@
--- Migration: 001_init.sql
+-- Migration: 001_init.up.sql
 -- Description: Create initial users table
 
 CREATE TABLE IF NOT EXISTS users (
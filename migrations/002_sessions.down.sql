@@ -0,0 +1,4 @@
+-- Migration: 002_sessions.down.sql
+-- Description: Drop sessions table
+
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,27 @@
+-- Migration: 002_sessions.up.sql
+-- Description: Create sessions table for tracking logins per device
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_label VARCHAR(100) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- Add comments for documentation
+COMMENT ON TABLE sessions IS 'Login sessions, one per refresh token family';
+COMMENT ON COLUMN sessions.id IS 'Session identifier, also the refresh token family and the sid claim';
+COMMENT ON COLUMN sessions.device_label IS 'Client supplied device name';
+COMMENT ON COLUMN sessions.ip_address IS 'IP address of the last request that used the session';
+COMMENT ON COLUMN sessions.user_agent IS 'User agent of the last request that used the session';
+COMMENT ON COLUMN sessions.last_seen_at IS 'Timestamp when the session was last refreshed';
+COMMENT ON COLUMN sessions.expires_at IS 'Timestamp when the refresh token expires';
+COMMENT ON COLUMN sessions.revoked_at IS 'Timestamp when the session was logged out or revoked';
@@ -0,0 +1,5 @@
+-- Migration: 003_roles.down.sql
+-- Description: Remove user roles
+
+DROP INDEX IF EXISTS idx_users_role;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
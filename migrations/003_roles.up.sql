@@ -0,0 +1,12 @@
+-- Migration: 003_roles.up.sql
+-- Description: Add a role to users for role-based access control
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user'
+    CONSTRAINT users_role_check CHECK (role IN ('user', 'support', 'admin'));
+
+-- Staff accounts are few; a partial index keeps listing them cheap
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role) WHERE role <> 'user';
+
+-- Add comments for documentation
+COMMENT ON COLUMN users.role IS 'Access role: user, support or admin';
@@ -0,0 +1,29 @@
+-- Migration: 004_profile.up.sql
+-- Description: Add editable profile fields to users and keep updated_at current
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS display_name VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS email VARCHAR(254) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS avatar_url VARCHAR(2048) NOT NULL DEFAULT '';
+
+-- Set updated_at on every update, whichever code path writes the row
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_set_updated_at ON users;
+CREATE TRIGGER users_set_updated_at
+    BEFORE UPDATE ON users
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- Add comments for documentation
+COMMENT ON COLUMN users.display_name IS 'Name shown to other users, empty if not set';
+COMMENT ON COLUMN users.email IS 'Contact email (lowercase), not verified';
+COMMENT ON COLUMN users.locale IS 'Preferred BCP 47 language tag, e.g. en-US';
+COMMENT ON COLUMN users.timezone IS 'IANA time zone, e.g. Europe/Berlin';
+COMMENT ON COLUMN users.avatar_url IS 'HTTPS URL of the profile picture';
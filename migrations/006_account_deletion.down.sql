@@ -0,0 +1,15 @@
+-- Migration: 006_account_deletion.down.sql
+-- Description: Remove soft deletion and audit events
+
+DROP TABLE IF EXISTS audit_events;
+
+-- Accounts pending purge are removed now, the unique constraint cannot hold them
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_purge_after;
+DROP INDEX IF EXISTS idx_users_phone_active;
+ALTER TABLE users ADD CONSTRAINT users_phone_key UNIQUE (phone);
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS purge_after;
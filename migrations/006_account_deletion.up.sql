@@ -0,0 +1,31 @@
+-- Migration: 006_account_deletion.up.sql
+-- Description: Soft deletion of accounts and audit events for data exports
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS purge_after TIMESTAMP;
+
+-- A deleted account keeps its row until it is purged, so the phone is only
+-- unique among active accounts and can be registered again right away
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_phone_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone_active ON users(phone) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_users_purge_after ON users(purge_after) WHERE purge_after IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events(user_id, created_at);
+
+-- Add comments for documentation
+COMMENT ON COLUMN users.deleted_at IS 'Timestamp when the user deleted the account, NULL while active';
+COMMENT ON COLUMN users.purge_after IS 'Timestamp after which the deleted account is removed for good';
+COMMENT ON TABLE audit_events IS 'Security relevant account events, included in data exports';
+COMMENT ON COLUMN audit_events.event_type IS 'Event such as login, phone_changed or account_deleted';
+COMMENT ON COLUMN audit_events.metadata IS 'Event specific details as string key/value pairs';
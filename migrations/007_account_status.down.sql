@@ -0,0 +1,8 @@
+-- Migration: 007_account_status.down.sql
+-- Description: Remove account status
+
+DROP INDEX IF EXISTS idx_users_status;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS status_reason,
+    DROP COLUMN IF EXISTS status_expires_at;
@@ -0,0 +1,16 @@
+-- Migration: 007_account_status.up.sql
+-- Description: Account status so admins can suspend or ban users
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active'
+    CONSTRAINT users_status_check CHECK (status IN ('active', 'suspended', 'banned')),
+    ADD COLUMN IF NOT EXISTS status_reason VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS status_expires_at TIMESTAMP;
+
+-- Blocked accounts are few; a partial index keeps listing them cheap
+CREATE INDEX IF NOT EXISTS idx_users_status ON users(status) WHERE status <> 'active';
+
+-- Add comments for documentation
+COMMENT ON COLUMN users.status IS 'Account status: active, suspended or banned';
+COMMENT ON COLUMN users.status_reason IS 'Reason given by the admin who changed the status';
+COMMENT ON COLUMN users.status_expires_at IS 'Timestamp when a suspension ends, NULL if it does not end';
@@ -0,0 +1,11 @@
+// Package migrations embeds the versioned SQL migrations. Files are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql. Versions are shared
+// with the Go migrations in store.GoMigrations:
+//
+//	005_normalize_phones  backfill of users.phone to E.164
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit event types
+const (
+	AuditEventRegistration   = "registration"
+	AuditEventLogin          = "login"
+	AuditEventProfileUpdated = "profile_updated"
+	AuditEventPhoneChanged   = "phone_changed"
+	AuditEventAccountDeleted = "account_deleted"
+	AuditEventStatusChanged  = "status_changed"
+)
+
+// AuditEvent records a security relevant change to an account
+type AuditEvent struct {
+	ID        uuid.UUID         `json:"id" db:"id"`
+	UserID    uuid.UUID         `json:"user_id" db:"user_id"`
+	Type      string            `json:"type" db:"event_type"`
+	IPAddress string            `json:"ip_address" db:"ip_address"`
+	UserAgent string            `json:"user_agent" db:"user_agent"`
+	Metadata  map[string]string `json:"metadata" db:"metadata"`
+	CreatedAt time.Time         `json:"created_at" db:"created_at"`
+}
+
+func NewAuditEvent(userID uuid.UUID, eventType string, client ClientInfo, metadata map[string]string) *AuditEvent {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	return &AuditEvent{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Type:      eventType,
+		IPAddress: client.IPAddress,
+		UserAgent: TruncateUserAgent(client.UserAgent),
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+	}
+}
+
+type AccountDeletionResponse struct {
+	Message    string    `json:"message"`
+	PurgeAfter time.Time `json:"purge_after"`
+}
+
+// AccountExport is everything stored about a user, returned by the data export
+type AccountExport struct {
+	ExportedAt  time.Time    `json:"exported_at"`
+	User        User         `json:"user"`
+	Sessions    []Session    `json:"sessions"`
+	AuditEvents []AuditEvent `json:"audit_events"`
+}
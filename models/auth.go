@@ -1,23 +1,67 @@
 package models
 
+import "time"
+
 type RequestOTPRequest struct {
-	Phone string `json:"phone" binding:"required"`
+	Phone string `json:"phone" binding:"required,max=32"`
 }
 
 type RequestOTPResponse struct {
-	Message string `json:"message"`
-	Phone   string `json:"phone"`
+	Message           string `json:"message"`
+	Phone             string `json:"phone"`
+	ExpiresIn         int    `json:"expires_in"`
+	ResendAvailableIn int    `json:"resend_available_in"`
 }
 
 type VerifyOTPRequest struct {
-	Phone string `json:"phone" binding:"required"`
-	OTP   string `json:"otp" binding:"required,len=6"`
+	Phone       string `json:"phone" binding:"required,max=32"`
+	OTP         string `json:"otp" binding:"required"`
+	DeviceLabel string `json:"device_label" binding:"max=100"`
+}
+
+type ChangePhoneRequest struct {
+	Phone string `json:"phone" binding:"required,max=32"`
+}
+
+type ChangePhoneResponse struct {
+	Message                      string `json:"message"`
+	Phone                        string `json:"phone"`
+	ExpiresIn                    int    `json:"expires_in"`
+	ResendAvailableIn            int    `json:"resend_available_in"`
+	OldPhoneVerificationRequired bool   `json:"old_phone_verification_required"`
+}
+
+// VerifyPhoneChangeRequest confirms a phone change with the code sent to the
+// new number and, if required, the code sent to the current number
+type VerifyPhoneChangeRequest struct {
+	Phone       string `json:"phone" binding:"required,max=32"`
+	OTP         string `json:"otp" binding:"required"`
+	OldOTP      string `json:"old_otp"`
+	DeviceLabel string `json:"device_label" binding:"max=100"`
 }
 
 type VerifyOTPResponse struct {
-	Message     string       `json:"message"`
-	AccessToken string       `json:"access_token"`
-	User        UserResponse `json:"user"`
+	Message      string       `json:"message"`
+	AccessToken  string       `json:"access_token"`
+	RefreshToken string       `json:"refresh_token"`
+	TokenType    string       `json:"token_type"`
+	ExpiresIn    int          `json:"expires_in"`
+	User         UserResponse `json:"user"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
 }
 
 type AuthError struct {
@@ -26,8 +70,57 @@ type AuthError struct {
 	Code    string `json:"code,omitempty"`
 }
 
+type InvalidOTPError struct {
+	Error             string `json:"error"`
+	Message           string `json:"message"`
+	RemainingAttempts int    `json:"remaining_attempts"`
+}
+
+// AccountSuspendedError is returned to suspended and banned users when they
+// sign in or use a token
+type AccountSuspendedError struct {
+	Error     string        `json:"error"`
+	Message   string        `json:"message"`
+	Status    AccountStatus `json:"status"`
+	Reason    string        `json:"reason,omitempty"`
+	ExpiresAt *time.Time    `json:"expires_at,omitempty"`
+}
+
+// NewAccountSuspendedError builds the response for a blocked account. Reason
+// and expiresAt are optional.
+func NewAccountSuspendedError(status AccountStatus, reason string, expiresAt *time.Time) AccountSuspendedError {
+	message := "This account has been suspended"
+	if status == AccountStatusBanned {
+		message = "This account has been banned"
+	}
+	return AccountSuspendedError{
+		Error:     "account_suspended",
+		Message:   message,
+		Status:    status,
+		Reason:    reason,
+		ExpiresAt: expiresAt,
+	}
+}
+
 type RateLimitError struct {
 	Error      string `json:"error"`
 	Message    string `json:"message"`
 	RetryAfter int    `json:"retry_after_seconds"`
 }
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
@@ -0,0 +1,45 @@
+package models
+
+// Role is the access level of a user
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
+	RoleAdmin   Role = "admin"
+)
+
+// Permission is an action on a resource, granted through roles
+type Permission string
+
+const (
+	// PermissionReadUsers allows reading any user's record, not just your own
+	PermissionReadUsers Permission = "users:read"
+	// PermissionListUsers allows listing and searching all users
+	PermissionListUsers Permission = "users:list"
+	// PermissionManageUsers allows changing other users' accounts
+	PermissionManageUsers Permission = "users:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:    {},
+	RoleSupport: {PermissionReadUsers, PermissionListUsers},
+	RoleAdmin:   {PermissionReadUsers, PermissionListUsers, PermissionManageUsers},
+}
+
+// IsValid reports whether r is a known role
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants the permission. Unknown roles have no
+// permissions.
+func (r Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Session struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	DeviceLabel string     `json:"device_label" db:"device_label"`
+	IPAddress   string     `json:"ip_address" db:"ip_address"`
+	UserAgent   string     `json:"user_agent" db:"user_agent"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// ClientInfo describes the client making a request
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+type SessionResponse struct {
+	ID          uuid.UUID `json:"id"`
+	DeviceLabel string    `json:"device_label"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Current     bool      `json:"current"`
+}
+
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// maxUserAgentLength bounds the stored user agent, which is client controlled
+const maxUserAgentLength = 512
+
+func NewSession(id, userID uuid.UUID, deviceLabel string, client ClientInfo, expiresAt time.Time) *Session {
+	now := time.Now()
+	return &Session{
+		ID:          id,
+		UserID:      userID,
+		DeviceLabel: deviceLabel,
+		IPAddress:   client.IPAddress,
+		UserAgent:   TruncateUserAgent(client.UserAgent),
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   expiresAt,
+	}
+}
+
+func TruncateUserAgent(userAgent string) string {
+	if len(userAgent) > maxUserAgentLength {
+		return strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+	return userAgent
+}
+
+func (s *Session) ToResponse(currentSessionID string) SessionResponse {
+	return SessionResponse{
+		ID:          s.ID,
+		DeviceLabel: s.DeviceLabel,
+		IPAddress:   s.IPAddress,
+		UserAgent:   s.UserAgent,
+		CreatedAt:   s.CreatedAt,
+		LastSeenAt:  s.LastSeenAt,
+		ExpiresAt:   s.ExpiresAt,
+		Current:     s.ID.String() == currentSessionID,
+	}
+}
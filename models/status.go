@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// AccountStatus controls whether a user may sign in
+type AccountStatus string
+
+const (
+	AccountStatusActive    AccountStatus = "active"
+	AccountStatusSuspended AccountStatus = "suspended"
+	AccountStatusBanned    AccountStatus = "banned"
+)
+
+// IsValid reports whether s is a known status
+func (s AccountStatus) IsValid() bool {
+	switch s {
+	case AccountStatusActive, AccountStatusSuspended, AccountStatusBanned:
+		return true
+	}
+	return false
+}
+
+// UpdateStatusRequest changes the status of a user. Only suspensions can
+// have an expiry; without one the suspension lasts until it is lifted.
+type UpdateStatusRequest struct {
+	Status    AccountStatus `json:"status" binding:"required,oneof=active suspended banned"`
+	Reason    string        `json:"reason" binding:"max=500"`
+	ExpiresAt *time.Time    `json:"expires_at"`
+}
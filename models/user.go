@@ -7,11 +7,20 @@ import (
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	Phone        string    `json:"phone" db:"phone"`
-	RegisteredAt time.Time `json:"registered_at" db:"registered_at"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID     `json:"id" db:"id"`
+	Phone           string        `json:"phone" db:"phone"`
+	Role            Role          `json:"role" db:"role"`
+	DisplayName     string        `json:"display_name" db:"display_name"`
+	Email           string        `json:"email" db:"email"`
+	Locale          string        `json:"locale" db:"locale"`
+	Timezone        string        `json:"timezone" db:"timezone"`
+	AvatarURL       string        `json:"avatar_url" db:"avatar_url"`
+	Status          AccountStatus `json:"status" db:"status"`
+	StatusReason    string        `json:"status_reason" db:"status_reason"`
+	StatusExpiresAt *time.Time    `json:"status_expires_at" db:"status_expires_at"`
+	RegisteredAt    time.Time     `json:"registered_at" db:"registered_at"`
+	CreatedAt       time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at" db:"updated_at"`
 }
 
 type CreateUserRequest struct {
@@ -19,9 +28,29 @@ type CreateUserRequest struct {
 }
 
 type UserResponse struct {
-	ID           uuid.UUID `json:"id"`
-	Phone        string    `json:"phone"`
-	RegisteredAt time.Time `json:"registered_at"`
+	ID              uuid.UUID     `json:"id"`
+	Phone           string        `json:"phone"`
+	Role            Role          `json:"role"`
+	DisplayName     string        `json:"display_name"`
+	Email           string        `json:"email"`
+	Locale          string        `json:"locale"`
+	Timezone        string        `json:"timezone"`
+	AvatarURL       string        `json:"avatar_url"`
+	Status          AccountStatus `json:"status"`
+	StatusReason    string        `json:"status_reason,omitempty"`
+	StatusExpiresAt *time.Time    `json:"status_expires_at,omitempty"`
+	RegisteredAt    time.Time     `json:"registered_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+// UpdateProfileRequest changes the profile of the current user. Omitted
+// fields are left unchanged and an empty string clears a field.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100"`
+	Email       *string `json:"email" binding:"omitempty,max=254"`
+	Locale      *string `json:"locale" binding:"omitempty,max=35"`
+	Timezone    *string `json:"timezone" binding:"omitempty,max=64"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitempty,max=2048"`
 }
 
 type UserListResponse struct {
@@ -48,6 +77,8 @@ func NewUser(phone string) *User {
 	return &User{
 		ID:           uuid.New(),
 		Phone:        phone,
+		Role:         RoleUser,
+		Status:       AccountStatusActive,
 		RegisteredAt: now,
 		CreatedAt:    now,
 		UpdatedAt:    now,
@@ -56,8 +87,27 @@ func NewUser(phone string) *User {
 
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:           u.ID,
-		Phone:        u.Phone,
-		RegisteredAt: u.RegisteredAt,
+		ID:              u.ID,
+		Phone:           u.Phone,
+		Role:            u.Role,
+		DisplayName:     u.DisplayName,
+		Email:           u.Email,
+		Locale:          u.Locale,
+		Timezone:        u.Timezone,
+		AvatarURL:       u.AvatarURL,
+		Status:          u.Status,
+		StatusReason:    u.StatusReason,
+		StatusExpiresAt: u.StatusExpiresAt,
+		RegisteredAt:    u.RegisteredAt,
+		UpdatedAt:       u.UpdatedAt,
+	}
+}
+
+// IsBlocked reports whether the user is suspended or banned at the given
+// time. A suspension with an expiry ends by itself once it has passed.
+func (u *User) IsBlocked(now time.Time) bool {
+	if u.Status == "" || u.Status == AccountStatusActive {
+		return false
 	}
+	return u.StatusExpiresAt == nil || now.Before(*u.StatusExpiresAt)
 }
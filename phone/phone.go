@@ -0,0 +1,81 @@
+// Package phone parses user supplied phone numbers into the E.164 form that
+// is used for storage, Redis keys and rate limiting, so that one subscriber
+// always maps to the same string however the number was typed.
+package phone
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+var (
+	ErrInvalid   = errors.New("not a valid phone number")
+	ErrNotMobile = errors.New("not a mobile phone number")
+)
+
+// e164Pattern matches the canonical form produced by Normalize
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// Normalize parses a number given in international format or in the national
+// format of defaultRegion (an ISO 3166-1 alpha-2 code, empty to require the
+// international format) and returns it in E.164, e.g. +12015550123
+func Normalize(raw, defaultRegion string) (string, error) {
+	number, err := parse(raw, defaultRegion)
+	if err != nil {
+		return "", err
+	}
+
+	return phonenumbers.Format(number, phonenumbers.E164), nil
+}
+
+// NormalizeMobile is like Normalize but also rejects numbers that cannot
+// receive SMS, such as fixed lines, toll-free and premium rate numbers.
+// Numbers whose plan does not distinguish mobile from fixed lines, as in
+// the US, are accepted.
+func NormalizeMobile(raw, defaultRegion string) (string, error) {
+	number, err := parse(raw, defaultRegion)
+	if err != nil {
+		return "", err
+	}
+
+	switch phonenumbers.GetNumberType(number) {
+	case phonenumbers.MOBILE, phonenumbers.FIXED_LINE_OR_MOBILE:
+	default:
+		return "", ErrNotMobile
+	}
+
+	return phonenumbers.Format(number, phonenumbers.E164), nil
+}
+
+// IsE164 reports whether s is already in E.164 form. It checks the syntax
+// only; use Normalize to check that the number exists.
+func IsE164(s string) bool {
+	return e164Pattern.MatchString(s)
+}
+
+// ValidRegion reports whether region can be used as a default region
+func ValidRegion(region string) bool {
+	return phonenumbers.GetSupportedRegions()[strings.ToUpper(region)]
+}
+
+func parse(raw, defaultRegion string) (*phonenumbers.PhoneNumber, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, ErrInvalid
+	}
+
+	region := strings.ToUpper(defaultRegion)
+	if region == "" {
+		region = phonenumbers.UNKNOWN_REGION
+	}
+
+	number, err := phonenumbers.Parse(raw, region)
+	if err != nil || !phonenumbers.IsValidNumber(number) {
+		return nil, ErrInvalid
+	}
+
+	return number, nil
+}
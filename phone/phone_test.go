@@ -0,0 +1,90 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		region  string
+		want    string
+		wantErr error
+	}{
+		{"international", "+1 (201) 555-0123", "US", "+12015550123", nil},
+		{"international without plus", "12015550123", "US", "+12015550123", nil},
+		{"national in default region", "(201) 555-0123", "US", "+12015550123", nil},
+		{"international ignores default region", "+44 7911 123456", "US", "+447911123456", nil},
+		{"national in other region", "07911 123456", "GB", "+447911123456", nil},
+		{"international dialing prefix", "011 44 7911 123456", "US", "+447911123456", nil},
+		{"already E.164", "+447911123456", "", "+447911123456", nil},
+		{"surrounding whitespace", "  +1 201 555 0123\t", "", "+12015550123", nil},
+		{"lowercase region", "(201) 555-0123", "us", "+12015550123", nil},
+		{"national without default region", "201-555-0123", "", "", ErrInvalid},
+		{"national in wrong region", "07911 123456", "US", "", ErrInvalid},
+		{"fixed line", "020 7946 0958", "GB", "+442079460958", nil},
+		{"toll free", "+1 800 555 0199", "US", "+18005550199", nil},
+		// 555 is not an assigned area code, whichever way the number is typed
+		{"fictional area code formatted", "+1 (555) 010-0000", "US", "", ErrInvalid},
+		{"fictional area code digits", "15550100000", "US", "", ErrInvalid},
+		{"too short", "12345", "US", "", ErrInvalid},
+		{"letters", "abc", "US", "", ErrInvalid},
+		{"empty", "", "US", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.raw, tt.region)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Normalize(%q, %q) error = %v, want %v", tt.raw, tt.region, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q, %q) = %q, want %q", tt.raw, tt.region, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeMobile(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		region  string
+		want    string
+		wantErr error
+	}{
+		{"mobile", "07911 123456", "GB", "+447911123456", nil},
+		{"fixed line or mobile", "(201) 555-0123", "US", "+12015550123", nil},
+		{"international mobile", "+49 1512 3456789", "", "+4915123456789", nil},
+		{"fixed line", "020 7946 0958", "GB", "", ErrNotMobile},
+		{"toll free", "1-800-253-0000", "US", "", ErrNotMobile},
+		{"premium rate", "+44 909 8790000", "", "", ErrNotMobile},
+		{"invalid", "+1 (555) 010-0000", "US", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeMobile(tt.raw, tt.region)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeMobile(%q, %q) error = %v, want %v", tt.raw, tt.region, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeMobile(%q, %q) = %q, want %q", tt.raw, tt.region, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeFormatsAgree(t *testing.T) {
+	// Every way of typing one subscriber maps to the same string
+	inputs := []string{"+1 (201) 555-0123", "12015550123", "+12015550123", "201.555.0123", "(201) 555-0123"}
+
+	for _, raw := range inputs {
+		got, err := Normalize(raw, "US")
+		if err != nil || got != "+12015550123" {
+			t.Errorf("Normalize(%q) = %q, %v, want +12015550123", raw, got, err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"otp-auth-backend/config"
+	"otp-auth-backend/logging"
+)
+
+// ConsoleSender prints messages to stderr instead of delivering them. The
+// code is printed in clear text so a developer can sign in, which is why the
+// sender has to be enabled explicitly with OTP_SENDER_CONSOLE_ENABLED. The
+// phone is masked and stdout is left to the logger.
+type ConsoleSender struct{}
+
+func init() {
+	Register("console", func(cfg *config.OTPConfig) (Sender, error) {
+		if !cfg.SenderConsole {
+			return nil, fmt.Errorf("OTP_SENDER_CONSOLE_ENABLED must be set to use the console sender, which prints codes in clear text")
+		}
+		return &ConsoleSender{}, nil
+	})
+}
+
+func (s *ConsoleSender) Name() string {
+	return "console"
+}
+
+func (s *ConsoleSender) Send(ctx context.Context, msg *Message) error {
+	_, err := fmt.Fprintf(os.Stderr, "OTP message for phone %s: %s\n", logging.MaskPhone(msg.Phone), msg.Body)
+	return err
+}
@@ -0,0 +1,64 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"otp-auth-backend/config"
+)
+
+// FileSender appends every message as a JSON line to a local file,
+// which is useful for local development and end-to-end tests
+type FileSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func init() {
+	Register("file", func(cfg *config.OTPConfig) (Sender, error) {
+		if cfg.SenderFilePath == "" {
+			return nil, fmt.Errorf("OTP_SENDER_FILE_PATH is required for the file sender")
+		}
+		return &FileSender{path: cfg.SenderFilePath}, nil
+	})
+}
+
+func (s *FileSender) Name() string {
+	return "file"
+}
+
+func (s *FileSender) Send(ctx context.Context, msg *Message) error {
+	line, err := json.Marshal(struct {
+		Phone    string            `json:"phone"`
+		Message  string            `json:"message"`
+		Metadata map[string]string `json:"metadata,omitempty"`
+		SentAt   time.Time         `json:"sent_at"`
+	}{
+		Phone:    msg.Phone,
+		Message:  msg.Body,
+		Metadata: msg.Metadata,
+		SentAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return &DeliveryError{Provider: s.Name(), Phone: msg.Phone, Err: err}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return &DeliveryError{Provider: s.Name(), Phone: msg.Phone, Temporary: true, Err: err}
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return &DeliveryError{Provider: s.Name(), Phone: msg.Phone, Temporary: true, Err: err}
+	}
+
+	return nil
+}
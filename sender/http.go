@@ -0,0 +1,78 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"otp-auth-backend/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// HTTPSender posts messages as JSON to a configurable endpoint, such as a
+// local mock of an SMS gateway
+type HTTPSender struct {
+	url    string
+	client *http.Client
+}
+
+func init() {
+	Register("http", func(cfg *config.OTPConfig) (Sender, error) {
+		if cfg.SenderHTTPURL == "" {
+			return nil, fmt.Errorf("OTP_SENDER_HTTP_URL is required for the http sender")
+		}
+		return &HTTPSender{
+			url:    cfg.SenderHTTPURL,
+			client: &http.Client{Timeout: cfg.SenderTimeout},
+		}, nil
+	})
+}
+
+func (s *HTTPSender) Name() string {
+	return "http"
+}
+
+func (s *HTTPSender) Send(ctx context.Context, msg *Message) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"phone":    msg.Phone,
+		"message":  msg.Body,
+		"metadata": msg.Metadata,
+	})
+	if err != nil {
+		return &DeliveryError{Provider: s.Name(), Phone: msg.Phone, Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return &DeliveryError{Provider: s.Name(), Phone: msg.Phone, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Propagate the trace so the gateway's logs can be correlated with ours
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &DeliveryError{Provider: s.Name(), Phone: msg.Phone, Temporary: true, Err: err}
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &DeliveryError{
+			Provider:  s.Name(),
+			Phone:     msg.Phone,
+			Temporary: resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+			Err:       fmt.Errorf("unexpected status code %d", resp.StatusCode),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"otp-auth-backend/config"
+)
+
+// Message is a single outbound OTP notification
+type Message struct {
+	Phone    string
+	Body     string
+	Metadata map[string]string
+}
+
+// Sender delivers OTP messages to a phone number
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Factory builds a Sender from the OTP configuration
+type Factory func(cfg *config.OTPConfig) (Sender, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a sender provider available under the given name
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("sender: Register factory is nil")
+	}
+	if _, exists := registry[name]; exists {
+		panic("sender: Register called twice for provider " + name)
+	}
+	registry[name] = factory
+}
+
+// Providers returns the names of all registered providers
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the sender selected by cfg.Sender
+func New(cfg *config.OTPConfig) (Sender, error) {
+	registryMu.RLock()
+	factory, ok := registry[cfg.Sender]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown OTP sender %q (available: %v)", cfg.Sender, Providers())
+	}
+
+	s, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize OTP sender %q: %w", cfg.Sender, err)
+	}
+
+	return s, nil
+}
+
+// DeliveryError is returned when a provider fails to deliver a message
+type DeliveryError struct {
+	Provider  string
+	Phone     string
+	Temporary bool
+	Err       error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("%s sender failed to deliver message to %s: %v", e.Provider, e.Phone, e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"otp-auth-backend/config"
+	"otp-auth-backend/logging"
+	"otp-auth-backend/models"
+	"otp-auth-backend/store"
+)
+
+// purgeBatchSize bounds the number of users removed by a single purge query
+const purgeBatchSize = 500
+
+var (
+	// ErrOwnStatus is returned when an admin tries to change their own status
+	ErrOwnStatus = errors.New("cannot change the status of your own account")
+	// ErrManagerStatus is returned when suspending or banning a user who can
+	// manage users too, so one admin cannot lock the others out
+	ErrManagerStatus = errors.New("cannot change the status of a user manager")
+)
+
+// StatusValidationError describes why a status change was rejected
+type StatusValidationError struct {
+	Reason string
+}
+
+func (e *StatusValidationError) Error() string {
+	return e.Reason
+}
+
+type AccountService struct {
+	userRepo    *store.UserRepository
+	sessionRepo *store.SessionRepository
+	auditRepo   *store.AuditRepository
+	redisStore  *store.RedisStore
+	authService *AuthService
+	config      *config.Config
+}
+
+func NewAccountService(userRepo *store.UserRepository, sessionRepo *store.SessionRepository, auditRepo *store.AuditRepository, redisStore *store.RedisStore, authService *AuthService, config *config.Config) *AccountService {
+	return &AccountService{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		auditRepo:   auditRepo,
+		redisStore:  redisStore,
+		authService: authService,
+		config:      config,
+	}
+}
+
+// DeleteAccount logs the user out everywhere and soft-deletes the account.
+// The phone can register a new account right away; the old row is purged
+// by RunPurger once ACCOUNT_PURGE_DELAY has passed.
+func (s *AccountService) DeleteAccount(ctx context.Context, userID string, client models.ClientInfo) (*models.AccountDeletionResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	// Revoke first so no token outlives the account
+	if err := s.authService.LogoutAll(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	purgeAfter := time.Now().Add(s.config.Account.PurgeDelay)
+	deleted, err := s.userRepo.SoftDelete(ctx, user.ID, purgeAfter)
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, ErrUserNotFound
+	}
+
+	recordAudit(ctx, s.auditRepo, models.NewAuditEvent(user.ID, models.AuditEventAccountDeleted, client,
+		map[string]string{"purge_after": purgeAfter.UTC().Format(time.RFC3339)}))
+
+	// The account is gone whether or not this succeeds; leftover keys expire
+	// on their own
+	if err := s.deleteRedisState(ctx, user); err != nil {
+		logging.FromContext(ctx).Warn("Failed to remove Redis state of deleted account",
+			"user_id", userID, "error", err)
+	}
+
+	logging.FromContext(ctx).Info("Deleted account", "user_id", userID, "purge_after", purgeAfter)
+
+	return &models.AccountDeletionResponse{
+		Message:    "Account deleted",
+		PurgeAfter: purgeAfter,
+	}, nil
+}
+
+// deleteRedisState removes the OTP and rate limiter state kept for the
+// user's phone
+func (s *AccountService) deleteRedisState(ctx context.Context, user *models.User) error {
+	userID := user.ID.String()
+	for _, purpose := range []OTPPurpose{OTPPurposeLogin, OTPPurposeChangePhone} {
+		if err := s.redisStore.DeleteOTPState(ctx, otpSubject(purpose, userID, user.Phone)); err != nil {
+			return err
+		}
+	}
+
+	var keys []string
+	for _, policy := range s.config.RateLimit.Policies {
+		if policy.Dimension == config.RateLimitDimensionPhone {
+			keys = append(keys, policy.Name+":"+user.Phone)
+		}
+	}
+
+	return s.redisStore.ResetRate(ctx, keys...)
+}
+
+// ExportAccount returns everything stored about the user
+func (s *AccountService) ExportAccount(ctx context.Context, userID string) (*models.AccountExport, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	sessions, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.auditRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AccountExport{
+		ExportedAt:  time.Now(),
+		User:        *user,
+		Sessions:    sessions,
+		AuditEvents: events,
+	}, nil
+}
+
+// UpdateStatus suspends, bans or reactivates a user on behalf of actorID.
+// Blocking a user revokes all of their tokens and refuses new sign-ins until
+// the status is lifted or the suspension expires.
+func (s *AccountService) UpdateStatus(ctx context.Context, actorID, userID string, req *models.UpdateStatusRequest, client models.ClientInfo) (*models.UserResponse, error) {
+	if actorID == userID {
+		return nil, ErrOwnStatus
+	}
+
+	reason, expiresAt := strings.TrimSpace(req.Reason), req.ExpiresAt
+	switch req.Status {
+	case models.AccountStatusActive:
+		if expiresAt != nil {
+			return nil, &StatusValidationError{Reason: "expires_at is only allowed when suspending"}
+		}
+		reason = ""
+	case models.AccountStatusSuspended:
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			return nil, &StatusValidationError{Reason: "expires_at must be in the future"}
+		}
+	case models.AccountStatusBanned:
+		if expiresAt != nil {
+			return nil, &StatusValidationError{Reason: "bans do not expire; suspend the account instead"}
+		}
+	default:
+		return nil, &StatusValidationError{Reason: fmt.Sprintf("unknown status %q", req.Status)}
+	}
+
+	// status_expires_at has no time zone and is read back as UTC, so the
+	// client's offset must not reach the database
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	// Reactivating a manager is allowed so a block from before they were
+	// granted the role can still be lifted
+	if req.Status != models.AccountStatusActive && user.Role.Can(models.PermissionManageUsers) {
+		return nil, ErrManagerStatus
+	}
+
+	updated, err := s.userRepo.UpdateStatus(ctx, user.ID, req.Status, reason, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		return nil, ErrUserNotFound
+	}
+
+	// The database is the source of truth for sign-ins; Redis carries the
+	// block to access token checks. Both steps are safe to repeat if the
+	// request fails halfway and is retried.
+	if req.Status == models.AccountStatusActive {
+		if err := s.redisStore.ClearAccountBlock(ctx, userID); err != nil {
+			return nil, fmt.Errorf("failed to lift account block: %w", err)
+		}
+	} else {
+		var expiration time.Duration
+		if expiresAt != nil {
+			expiration = time.Until(*expiresAt)
+		}
+		if err := s.redisStore.SetAccountBlock(ctx, userID, string(req.Status), expiration); err != nil {
+			return nil, fmt.Errorf("failed to block account: %w", err)
+		}
+		if err := s.authService.LogoutAll(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata := map[string]string{"status": string(req.Status), "changed_by": actorID}
+	if reason != "" {
+		metadata["reason"] = reason
+	}
+	if expiresAt != nil {
+		metadata["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	recordAudit(ctx, s.auditRepo, models.NewAuditEvent(user.ID, models.AuditEventStatusChanged, client, metadata))
+
+	logging.FromContext(ctx).Info("Changed account status",
+		"user_id", userID, "status", string(req.Status), "changed_by", actorID)
+
+	response := updated.ToResponse()
+	return &response, nil
+}
+
+// RunPurger hard-deletes soft-deleted accounts whose purge time has passed,
+// checking every interval until ctx is cancelled. Every replica may run it;
+// each account is removed by exactly one DELETE.
+func (s *AccountService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purge(ctx)
+		}
+	}
+}
+
+// purge removes due accounts in batches until none are left
+func (s *AccountService) purge(ctx context.Context) {
+	var total int64
+	for ctx.Err() == nil {
+		purged, err := s.userRepo.PurgeDeleted(ctx, time.Now(), purgeBatchSize)
+		if err != nil {
+			slog.Warn("Failed to purge deleted accounts", "error", err)
+			break
+		}
+		total += purged
+		if purged < purgeBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		slog.Info("Purged deleted accounts", "count", total)
+	}
+}
+
+// recordAudit stores an audit event. Failures are logged rather than
+// returned: the audited operation has already happened.
+func recordAudit(ctx context.Context, auditRepo *store.AuditRepository, event *models.AuditEvent) {
+	if err := auditRepo.Create(ctx, event); err != nil {
+		logging.FromContext(ctx).Warn("Failed to record audit event",
+			"type", event.Type, "user_id", event.UserID.String(), "error", err)
+	}
+}
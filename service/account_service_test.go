@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"otp-auth-backend/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newTestAccountService(t *testing.T) (*AccountService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	auth, mock := newTestAuthService(t)
+	return NewAccountService(auth.userRepo, auth.sessionRepo, auth.auditRepo, auth.redisStore, auth, auth.config), mock
+}
+
+// utcTime matches a time argument equal to want and in UTC
+type utcTime struct {
+	want time.Time
+}
+
+func (a utcTime) Match(v driver.Value) bool {
+	got, ok := v.(time.Time)
+	return ok && got.Location() == time.UTC && got.Equal(a.want)
+}
+
+// expectStatusUpdate expects the status change of user and returns the
+// updated row
+func expectStatusUpdate(mock sqlmock.Sqlmock, user *models.User, status models.AccountStatus, reason string, expiresAt any) {
+	updated := *user
+	updated.Status, updated.StatusReason = status, reason
+	if t, ok := expiresAt.(utcTime); ok {
+		updated.StatusExpiresAt = &t.want
+	}
+
+	mock.ExpectQuery("UPDATE users").
+		WithArgs(user.ID.String(), string(status), reason, expiresAt).
+		WillReturnRows(userRows(&updated))
+}
+
+func TestUpdateStatusValidation(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		actorID string
+		req     models.UpdateStatusRequest
+		want    error
+	}{
+		{"own account", "user-1", models.UpdateStatusRequest{Status: models.AccountStatusSuspended}, ErrOwnStatus},
+		{"reactivation with expiry", "admin", models.UpdateStatusRequest{Status: models.AccountStatusActive, ExpiresAt: &future}, nil},
+		{"suspension ending in the past", "admin", models.UpdateStatusRequest{Status: models.AccountStatusSuspended, ExpiresAt: &past}, nil},
+		{"ban with expiry", "admin", models.UpdateStatusRequest{Status: models.AccountStatusBanned, ExpiresAt: &future}, nil},
+		{"unknown status", "admin", models.UpdateStatusRequest{Status: "deleted"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestAccountService(t)
+
+			_, err := s.UpdateStatus(context.Background(), tt.actorID, "user-1", &tt.req, models.ClientInfo{})
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Errorf("got %v, want %v", err, tt.want)
+				}
+			} else {
+				var validationErr *StatusValidationError
+				if !errors.As(err, &validationErr) {
+					t.Errorf("got %v, want StatusValidationError", err)
+				}
+			}
+
+			// Rejected requests never reach the database
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusManager(t *testing.T) {
+	s, mock := newTestAccountService(t)
+	ctx := context.Background()
+	admin := newTestUser(models.RoleAdmin)
+
+	for _, status := range []models.AccountStatus{models.AccountStatusSuspended, models.AccountStatusBanned} {
+		expectGetUser(mock, admin)
+		_, err := s.UpdateStatus(ctx, "actor", admin.ID.String(), &models.UpdateStatusRequest{Status: status}, models.ClientInfo{})
+		if !errors.Is(err, ErrManagerStatus) {
+			t.Errorf("%s: got %v, want ErrManagerStatus", status, err)
+		}
+	}
+
+	// A block placed before the role was granted can still be lifted
+	admin.Status = models.AccountStatusSuspended
+	expectGetUser(mock, admin)
+	expectStatusUpdate(mock, admin, models.AccountStatusActive, "", nil)
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err := s.UpdateStatus(ctx, "actor", admin.ID.String(), &models.UpdateStatusRequest{Status: models.AccountStatusActive}, models.ClientInfo{}); err != nil {
+		t.Errorf("reactivating a manager: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateStatusSuspendAndReactivate(t *testing.T) {
+	s, mock := newTestAccountService(t)
+	ctx := context.Background()
+	user := newTestUser(models.RoleUser)
+	userID := user.ID.String()
+	tokens, _ := startTestSession(t, s.authService, mock, user)
+
+	// Sent with an offset; stored as the same instant in UTC
+	expiresAt := time.Now().Add(2 * time.Hour).Truncate(time.Second).In(time.FixedZone("UTC+5", 5*60*60))
+
+	expectGetUser(mock, user)
+	expectStatusUpdate(mock, user, models.AccountStatusSuspended, "abuse", utcTime{want: expiresAt})
+	mock.ExpectExec("UPDATE sessions").WithArgs(userID, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	response, err := s.UpdateStatus(ctx, "admin", userID, &models.UpdateStatusRequest{
+		Status:    models.AccountStatusSuspended,
+		Reason:    " abuse ",
+		ExpiresAt: &expiresAt,
+	}, models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+	if response.Status != models.AccountStatusSuspended {
+		t.Errorf("response status %q, want suspended", response.Status)
+	}
+
+	// Existing tokens stop working right away and report the suspension
+	_, err = s.authService.ValidateJWT(ctx, tokens.AccessToken)
+	var suspended *AccountSuspendedError
+	if !errors.As(err, &suspended) || suspended.Status != models.AccountStatusSuspended {
+		t.Errorf("access token of a suspended user: got %v, want AccountSuspendedError", err)
+	}
+	if _, err := s.authService.RefreshTokens(ctx, tokens.RefreshToken, models.ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh token of a suspended user: got %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// The block lasts as long as the suspension
+	ttl, err := s.redisStore.GetClient().TTL(ctx, "account_blocked:"+userID).Result()
+	if err != nil {
+		t.Fatalf("TTL: %v", err)
+	}
+	if ttl <= time.Hour || ttl > 2*time.Hour {
+		t.Errorf("account block TTL = %v, want the time left until the suspension ends", ttl)
+	}
+
+	user.Status, user.StatusReason = models.AccountStatusSuspended, "abuse"
+	expectGetUser(mock, user)
+	expectStatusUpdate(mock, user, models.AccountStatusActive, "", nil)
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if _, err := s.UpdateStatus(ctx, "admin", userID, &models.UpdateStatusRequest{
+		Status: models.AccountStatusActive,
+		Reason: "ignored when reactivating",
+	}, models.ClientInfo{}); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+
+	// New sign-ins are accepted again
+	user.Status, user.StatusReason = models.AccountStatusActive, ""
+	startTestSession(t, s.authService, mock, user)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
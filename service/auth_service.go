@@ -2,102 +2,395 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
 	"otp-auth-backend/config"
+	"otp-auth-backend/logging"
+	"otp-auth-backend/metrics"
 	"otp-auth-backend/models"
+	phonenumber "otp-auth-backend/phone"
 	"otp-auth-backend/store"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+)
+
+// AccountSuspendedError is returned when a suspended or banned user signs in
+// or presents a token. Reason and ExpiresAt are not known when the block was
+// detected from an access token, and are withheld before the phone has been
+// verified.
+type AccountSuspendedError struct {
+	Status    models.AccountStatus
+	Reason    string
+	ExpiresAt *time.Time
+}
+
+func (e *AccountSuspendedError) Error() string {
+	return "account is " + string(e.Status)
+}
+
+func accountSuspendedError(user *models.User) *AccountSuspendedError {
+	return &AccountSuspendedError{
+		Status:    user.Status,
+		Reason:    user.StatusReason,
+		ExpiresAt: user.StatusExpiresAt,
+	}
+}
+
 type AuthService struct {
-	otpService *OTPService
-	userRepo   *store.UserRepository
-	config     *config.Config
+	otpService  *OTPService
+	userRepo    *store.UserRepository
+	sessionRepo *store.SessionRepository
+	auditRepo   *store.AuditRepository
+	redisStore  *store.RedisStore
+	keySet      *KeySet
+	config      *config.Config
 }
 
-func NewAuthService(otpService *OTPService, userRepo *store.UserRepository, config *config.Config) *AuthService {
+func NewAuthService(otpService *OTPService, userRepo *store.UserRepository, sessionRepo *store.SessionRepository, auditRepo *store.AuditRepository, redisStore *store.RedisStore, keySet *KeySet, config *config.Config) *AuthService {
 	return &AuthService{
-		otpService: otpService,
-		userRepo:   userRepo,
-		config:     config,
+		otpService:  otpService,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		auditRepo:   auditRepo,
+		redisStore:  redisStore,
+		keySet:      keySet,
+		config:      config,
 	}
 }
 
-func (s *AuthService) VerifyOTP(ctx context.Context, req *models.VerifyOTPRequest) (*models.VerifyOTPResponse, error) {
+// RequestOTP sends a login code to phone unless it belongs to a suspended or
+// banned account
+func (s *AuthService) RequestOTP(ctx context.Context, rawPhone string) (*models.RequestOTPResponse, error) {
+	phone, err := s.otpService.NormalizePhone(rawPhone)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByPhone(ctx, phone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing user: %w", err)
+	}
+	// Anyone can ask for a code for any number, so the reason and end of
+	// the block are withheld from this unauthenticated caller
+	if user != nil && user.IsBlocked(time.Now()) {
+		return nil, &AccountSuspendedError{Status: user.Status}
+	}
+
+	return s.otpService.RequestOTP(ctx, phone)
+}
+
+func (s *AuthService) VerifyOTP(ctx context.Context, req *models.VerifyOTPRequest, client models.ClientInfo) (*models.VerifyOTPResponse, error) {
+	// Look the user up by the same E.164 form the OTP was stored under
+	phone, err := s.otpService.NormalizePhone(req.Phone)
+	if err != nil {
+		return nil, err
+	}
+
 	// Verify OTP
-	_, err := s.otpService.VerifyOTP(ctx, req.Phone, req.OTP)
+	err = s.otpService.VerifyOTP(ctx, phone, req.OTP)
 	if err != nil {
 		return nil, fmt.Errorf("OTP verification failed: %w", err)
 	}
 
 	// Check if user exists
-	existingUser, err := s.userRepo.GetByPhone(ctx, req.Phone)
+	existingUser, err := s.userRepo.GetByPhone(ctx, phone)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check existing user: %w", err)
 	}
 
 	var user *models.User
+	loginType, auditType := metrics.LoginTypeLogin, models.AuditEventLogin
 
 	if existingUser == nil {
 		// Create new user (registration)
-		user = models.NewUser(req.Phone)
+		user = models.NewUser(phone)
+		if s.isAdminPhone(phone) {
+			user.Role = models.RoleAdmin
+		}
 		err = s.userRepo.Create(ctx, user)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create user: %w", err)
 		}
+		loginType, auditType = metrics.LoginTypeRegistration, models.AuditEventRegistration
 	} else {
 		// User exists (login)
 		user = existingUser
+
+		// The account may have been blocked after the code was sent
+		if user.IsBlocked(time.Now()) {
+			return nil, accountSuspendedError(user)
+		}
+
+		// Bootstrap admins listed in ADMIN_PHONES that registered earlier
+		if user.Role != models.RoleAdmin && s.isAdminPhone(phone) {
+			if err := s.userRepo.UpdateRole(ctx, user.ID, models.RoleAdmin); err != nil {
+				return nil, err
+			}
+			user.Role = models.RoleAdmin
+			logging.FromContext(ctx).Info("Granted admin role from ADMIN_PHONES", "user_id", user.ID.String())
+		}
 	}
 
-	// Generate JWT token
-	token, err := s.generateJWT(user.ID.String())
+	tokens, err := s.startSession(ctx, user, req.DeviceLabel, client)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate JWT: %w", err)
+		return nil, err
 	}
 
+	metrics.Logins.WithLabelValues(loginType).Inc()
+	metrics.TokensIssued.WithLabelValues(metrics.GrantOTP).Inc()
+	recordAudit(ctx, s.auditRepo, models.NewAuditEvent(user.ID, auditType, client, nil))
+
 	return &models.VerifyOTPResponse{
-		Message:     "Authentication successful",
-		AccessToken: token,
-		User:        user.ToResponse(),
+		Message:      "Authentication successful",
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         user.ToResponse(),
 	}, nil
 }
 
-func (s *AuthService) generateJWT(userID string) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Subject:   userID,
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.JWT.Expiration)),
+// isAdminPhone reports whether an E.164 phone is listed in ADMIN_PHONES,
+// which may use any format the phone parser accepts
+func (s *AuthService) isAdminPhone(phone string) bool {
+	for _, adminPhone := range s.config.Security.AdminPhones {
+		normalized, err := phonenumber.Normalize(adminPhone, s.config.Phone.DefaultRegion)
+		if err == nil && normalized == phone {
+			return true
+		}
+	}
+	return false
+}
+
+// startSession records a new session for the user and issues its first token
+// pair. The session ID doubles as the refresh token family ID.
+func (s *AuthService) startSession(ctx context.Context, user *models.User, deviceLabel string, client models.ClientInfo) (*models.TokenResponse, error) {
+	session := models.NewSession(uuid.New(), user.ID, deviceLabel, client, time.Now().Add(s.config.JWT.RefreshExpiration))
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	err := s.redisStore.CreateRefreshFamily(ctx, session.ID.String(), user.ID.String(), s.config.JWT.RefreshExpiration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh token family: %w", err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.config.JWT.Secret))
+	return s.issueTokens(ctx, user, session.ID.String())
 }
 
-func (s *AuthService) ValidateJWT(tokenString string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// RefreshTokens exchanges a refresh token for a new access and refresh token
+// pair. Every refresh token can be used once; presenting one that was already
+// rotated revokes its whole family, logging out whoever holds the newer token.
+func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string, client models.ClientInfo) (*models.TokenResponse, error) {
+	status, record, err := s.redisStore.ConsumeRefreshToken(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+
+	switch status {
+	case store.RefreshTokenNotFound, store.RefreshTokenRevoked:
+		return nil, ErrInvalidRefreshToken
+	case store.RefreshTokenReused:
+		if err := s.revokeSession(ctx, record.FamilyID, record.UserID); err != nil {
+			return nil, err
 		}
-		return []byte(s.config.JWT.Secret), nil
-	})
+		logging.FromContext(ctx).Warn("Refresh token reuse detected, revoked token family",
+			"user_id", record.UserID, "session_id", record.FamilyID)
+		return nil, ErrRefreshTokenReused
+	}
 
+	// Make sure the user still exists before issuing new tokens
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse JWT: %w", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if user.IsBlocked(time.Now()) {
+		return nil, accountSuspendedError(user)
+	}
+
+	// The role is read again so role changes apply from the next refresh
+	tokens, err := s.issueTokens(ctx, user, record.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	metrics.TokensIssued.WithLabelValues(metrics.GrantRefresh).Inc()
+
+	// Refreshing is what keeps a session alive, so it counts as activity
+	err = s.sessionRepo.Touch(ctx, record.FamilyID, client, time.Now().Add(s.config.JWT.RefreshExpiration))
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to update session", "session_id", record.FamilyID, "error", err)
+	}
+
+	return tokens, nil
+}
+
+// issueTokens creates an access token and a refresh token in the given family
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, familyID string) (*models.TokenResponse, error) {
+	userID := user.ID.String()
+	accessToken, err := s.generateJWT(ctx, userID, user.Role, familyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate JWT: %w", err)
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	saved, err := s.redisStore.SaveRefreshToken(ctx, hashRefreshToken(refreshToken), store.RefreshTokenRecord{
+		UserID:   userID,
+		FamilyID: familyID,
+	}, s.config.JWT.RefreshExpiration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	if !saved {
+		// The family was revoked while this request was in flight
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return &models.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.config.JWT.Expiration.Seconds()),
+	}, nil
+}
+
+// Claims are the JWT claims of an access token
+type Claims struct {
+	SessionID    string      `json:"sid"`
+	TokenVersion int64       `json:"ver"`
+	Role         models.Role `json:"role"`
+	jwt.RegisteredClaims
+}
+
+func (s *AuthService) generateJWT(ctx context.Context, userID string, role models.Role, sessionID string) (string, error) {
+	// Tokens carry the user's current version so logout-all can invalidate them
+	version, err := s.redisStore.GetTokenVersion(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get token version: %w", err)
+	}
+
+	now := time.Now()
+	claims := Claims{
+		SessionID:    sessionID,
+		TokenVersion: version,
+		Role:         role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.JWT.Expiration)),
+		},
+	}
+
+	return s.keySet.Sign(claims)
+}
+
+// generateRefreshToken returns an opaque random token; only its hash is stored
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *AuthService) ValidateJWT(ctx context.Context, tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.keySet.Keyfunc)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT: %w", err)
 	}
 
 	if !token.Valid {
-		return "", fmt.Errorf("invalid JWT token")
+		return nil, fmt.Errorf("invalid JWT token")
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.ID == "" || claims.SessionID == "" {
+		return nil, fmt.Errorf("invalid JWT claims")
+	}
+
+	// Check the token against the revocation list, the user's token version
+	// and the session it belongs to
+	state, err := s.redisStore.GetTokenState(ctx, claims.ID, claims.Subject, claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	// Checked first: blocking a user also revokes their tokens, and the
+	// client should learn why
+	if state.BlockedStatus != "" {
+		return nil, &AccountSuspendedError{Status: models.AccountStatus(state.BlockedStatus)}
+	}
+
+	if state.Revoked || claims.TokenVersion < state.Version || !state.SessionActive {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public signing keys in JSON Web Key Set format
+func (s *AuthService) JWKS() models.JWKSResponse {
+	return s.keySet.JWKS()
+}
+
+// Logout revokes the presented access token and the session it belongs to
+func (s *AuthService) Logout(ctx context.Context, claims *Claims) error {
+	if err := s.redisStore.RevokeToken(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return s.revokeSession(ctx, claims.SessionID, claims.Subject)
+}
+
+// revokeSession ends a session: its refresh tokens stop working and so do
+// access tokens carrying its ID
+func (s *AuthService) revokeSession(ctx context.Context, sessionID, userID string) error {
+	if err := s.redisStore.RevokeRefreshFamily(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	if _, err := s.sessionRepo.Revoke(ctx, sessionID, userID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LogoutAll revokes every access and refresh token issued to the user
+func (s *AuthService) LogoutAll(ctx context.Context, userID string) error {
+	if _, err := s.redisStore.IncrementTokenVersion(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok {
-		return "", fmt.Errorf("invalid JWT claims")
+	if err := s.redisStore.RevokeAllRefreshFamilies(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
 	}
 
-	return claims.Subject, nil
+	return s.sessionRepo.RevokeAllByUser(ctx, userID)
 }
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"otp-auth-backend/config"
+	"otp-auth-backend/models"
+	"otp-auth-backend/store"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// newTestAuthService returns an AuthService backed by miniredis and a mocked
+// database
+func newTestAuthService(t *testing.T) (*AuthService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	redisStore, err := store.NewRedisStore(&config.RedisConfig{Host: mr.Host(), Port: mr.Port(), PoolSize: 64})
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { redisStore.Close() })
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	db := &store.Database{DB: sqlDB}
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Algorithm:         "HS256",
+			Secret:            "test-secret",
+			Expiration:        15 * time.Minute,
+			RefreshExpiration: 24 * time.Hour,
+		},
+		Phone: config.PhoneConfig{DefaultRegion: "US"},
+	}
+
+	keySet, err := LoadKeySet(&cfg.JWT)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	s := NewAuthService(nil, store.NewUserRepository(db), store.NewSessionRepository(db),
+		store.NewAuditRepository(db), redisStore, keySet, cfg)
+	return s, mock
+}
+
+func newTestUser(role models.Role) *models.User {
+	now := time.Now()
+	return &models.User{
+		ID:           uuid.New(),
+		Phone:        "+12015550123",
+		Role:         role,
+		Status:       models.AccountStatusActive,
+		RegisteredAt: now,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+// userRows returns users as rows selected with the repository's user columns
+func userRows(users ...*models.User) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "phone", "role", "display_name", "email", "locale", "timezone",
+		"avatar_url", "status", "status_reason", "status_expires_at", "registered_at", "created_at", "updated_at"})
+	for _, u := range users {
+		rows.AddRow(u.ID, u.Phone, string(u.Role), u.DisplayName, u.Email, u.Locale, u.Timezone,
+			u.AvatarURL, string(u.Status), u.StatusReason, u.StatusExpiresAt, u.RegisteredAt, u.CreatedAt, u.UpdatedAt)
+	}
+	return rows
+}
+
+func expectGetUser(mock sqlmock.Sqlmock, user *models.User) {
+	mock.ExpectQuery("FROM users").WithArgs(user.ID.String()).WillReturnRows(userRows(user))
+}
+
+// startTestSession signs the user in and returns the token pair and the
+// session ID
+func startTestSession(t *testing.T, s *AuthService, mock sqlmock.Sqlmock, user *models.User) (*models.TokenResponse, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	mock.ExpectExec("INSERT INTO sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+	tokens, err := s.startSession(ctx, user, "test device", models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+
+	claims, err := s.ValidateJWT(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateJWT of a new session: %v", err)
+	}
+	return tokens, claims.SessionID
+}
+
+// refresh exchanges a refresh token that is expected to be accepted
+func refresh(t *testing.T, s *AuthService, mock sqlmock.Sqlmock, user *models.User, refreshToken string) *models.TokenResponse {
+	t.Helper()
+
+	expectGetUser(mock, user)
+	mock.ExpectExec("UPDATE sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+	tokens, err := s.RefreshTokens(context.Background(), refreshToken, models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	return tokens
+}
+
+func TestRefreshTokensRotates(t *testing.T) {
+	s, mock := newTestAuthService(t)
+	ctx := context.Background()
+	user := newTestUser(models.RoleUser)
+
+	first, sessionID := startTestSession(t, s, mock, user)
+	second := refresh(t, s, mock, user, first.RefreshToken)
+
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("refresh returned the same refresh token")
+	}
+
+	claims, err := s.ValidateJWT(ctx, second.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateJWT of the refreshed token: %v", err)
+	}
+	if claims.SessionID != sessionID || claims.Subject != user.ID.String() {
+		t.Errorf("refreshed token has session %s of %s, want session %s of %s",
+			claims.SessionID, claims.Subject, sessionID, user.ID)
+	}
+
+	// The new refresh token can be rotated in turn
+	refresh(t, s, mock, user, second.RefreshToken)
+
+	if _, err := s.RefreshTokens(ctx, "unknown", models.ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown refresh token: got %v, want ErrInvalidRefreshToken", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRefreshTokensReuseRevokesFamily(t *testing.T) {
+	s, mock := newTestAuthService(t)
+	ctx := context.Background()
+	user := newTestUser(models.RoleUser)
+
+	first, sessionID := startTestSession(t, s, mock, user)
+	other, _ := startTestSession(t, s, mock, user)
+	second := refresh(t, s, mock, user, first.RefreshToken)
+
+	// Replaying the rotated token ends the session it belongs to
+	mock.ExpectExec("UPDATE sessions").
+		WithArgs(sessionID, user.ID.String(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err := s.RefreshTokens(ctx, first.RefreshToken, models.ClientInfo{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replayed refresh token: got %v, want ErrRefreshTokenReused", err)
+	}
+
+	// so whoever holds the newer tokens is logged out too
+	if _, err := s.RefreshTokens(ctx, second.RefreshToken, models.ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh token issued after the replayed one: got %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := s.ValidateJWT(ctx, second.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token of the revoked session: got %v, want ErrTokenRevoked", err)
+	}
+
+	// Other sessions of the user are left alone
+	if _, err := s.ValidateJWT(ctx, other.AccessToken); err != nil {
+		t.Errorf("access token of another session: %v", err)
+	}
+	refresh(t, s, mock, user, other.RefreshToken)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	s, mock := newTestAuthService(t)
+	ctx := context.Background()
+	user := newTestUser(models.RoleUser)
+
+	tokens, sessionID := startTestSession(t, s, mock, user)
+	other, _ := startTestSession(t, s, mock, user)
+
+	claims, err := s.ValidateJWT(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateJWT: %v", err)
+	}
+	mock.ExpectExec("UPDATE sessions").
+		WithArgs(sessionID, user.ID.String(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := s.Logout(ctx, claims); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if _, err := s.ValidateJWT(ctx, tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token after logout: got %v, want ErrTokenRevoked", err)
+	}
+	if _, err := s.RefreshTokens(ctx, tokens.RefreshToken, models.ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh token after logout: got %v, want ErrInvalidRefreshToken", err)
+	}
+
+	if _, err := s.ValidateJWT(ctx, other.AccessToken); err != nil {
+		t.Errorf("access token of another session: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLogoutAllRevokesEverySession(t *testing.T) {
+	s, mock := newTestAuthService(t)
+	ctx := context.Background()
+	user := newTestUser(models.RoleUser)
+
+	sessions := make([]*models.TokenResponse, 3)
+	for i := range sessions {
+		sessions[i], _ = startTestSession(t, s, mock, user)
+	}
+	// A token of another user must keep working
+	otherUser := newTestUser(models.RoleUser)
+	otherTokens, _ := startTestSession(t, s, mock, otherUser)
+
+	mock.ExpectExec("UPDATE sessions").
+		WithArgs(user.ID.String(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, int64(len(sessions))))
+	if err := s.LogoutAll(ctx, user.ID.String()); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+
+	for i, tokens := range sessions {
+		if _, err := s.ValidateJWT(ctx, tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("session %d: access token after logout-all: got %v, want ErrTokenRevoked", i, err)
+		}
+		if _, err := s.RefreshTokens(ctx, tokens.RefreshToken, models.ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("session %d: refresh token after logout-all: got %v, want ErrInvalidRefreshToken", i, err)
+		}
+	}
+
+	if _, err := s.ValidateJWT(ctx, otherTokens.AccessToken); err != nil {
+		t.Errorf("access token of another user: %v", err)
+	}
+
+	// Signing in again issues tokens with the new version
+	startTestSession(t, s, mock, user)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateJWTChecksEachRevocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(s *AuthService, claims *Claims) error
+	}{
+		{"token revoked", func(s *AuthService, claims *Claims) error {
+			return s.redisStore.RevokeToken(context.Background(), claims.ID, time.Minute)
+		}},
+		{"token version raised", func(s *AuthService, claims *Claims) error {
+			_, err := s.redisStore.IncrementTokenVersion(context.Background(), claims.Subject)
+			return err
+		}},
+		{"session ended", func(s *AuthService, claims *Claims) error {
+			return s.redisStore.RevokeRefreshFamily(context.Background(), claims.SessionID)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestAuthService(t)
+			ctx := context.Background()
+			tokens, _ := startTestSession(t, s, mock, newTestUser(models.RoleUser))
+
+			claims, err := s.ValidateJWT(ctx, tokens.AccessToken)
+			if err != nil {
+				t.Fatalf("ValidateJWT: %v", err)
+			}
+			if err := tt.revoke(s, claims); err != nil {
+				t.Fatalf("revoke: %v", err)
+			}
+
+			if _, err := s.ValidateJWT(ctx, tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+				t.Errorf("got %v, want ErrTokenRevoked", err)
+			}
+		})
+	}
+}
+
+func TestValidateJWTBlockedAccount(t *testing.T) {
+	s, mock := newTestAuthService(t)
+	ctx := context.Background()
+	user := newTestUser(models.RoleUser)
+	tokens, _ := startTestSession(t, s, mock, user)
+
+	if err := s.redisStore.SetAccountBlock(ctx, user.ID.String(), string(models.AccountStatusSuspended), 0); err != nil {
+		t.Fatalf("SetAccountBlock: %v", err)
+	}
+	// Blocking also revokes the tokens; the client should still learn why
+	if _, err := s.redisStore.IncrementTokenVersion(ctx, user.ID.String()); err != nil {
+		t.Fatalf("IncrementTokenVersion: %v", err)
+	}
+
+	_, err := s.ValidateJWT(ctx, tokens.AccessToken)
+	var suspended *AccountSuspendedError
+	if !errors.As(err, &suspended) || suspended.Status != models.AccountStatusSuspended {
+		t.Fatalf("got %v, want AccountSuspendedError for a suspended account", err)
+	}
+
+	if err := s.redisStore.ClearAccountBlock(ctx, user.ID.String()); err != nil {
+		t.Fatalf("ClearAccountBlock: %v", err)
+	}
+	if _, err := s.ValidateJWT(ctx, tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("after the block is lifted: got %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestRefreshTokensBlockedAccount(t *testing.T) {
+	s, mock := newTestAuthService(t)
+	ctx := context.Background()
+	user := newTestUser(models.RoleUser)
+	tokens, _ := startTestSession(t, s, mock, user)
+
+	expiresAt := time.Now().Add(time.Hour).UTC()
+	user.Status, user.StatusReason, user.StatusExpiresAt = models.AccountStatusSuspended, "abuse", &expiresAt
+	expectGetUser(mock, user)
+
+	_, err := s.RefreshTokens(ctx, tokens.RefreshToken, models.ClientInfo{})
+	var suspended *AccountSuspendedError
+	if !errors.As(err, &suspended) {
+		t.Fatalf("got %v, want AccountSuspendedError", err)
+	}
+	if suspended.Status != models.AccountStatusSuspended || suspended.Reason != "abuse" ||
+		suspended.ExpiresAt == nil || !suspended.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("got %+v, want the suspension details", suspended)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"otp-auth-backend/config"
+	"otp-auth-backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is a key identified by its kid. Retired keys have no private
+// half and are only used to verify tokens issued before a rotation.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeySet holds the keys used to sign and verify access tokens
+type KeySet struct {
+	secret []byte
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// LoadKeySet builds the key set for the configured algorithm. HS256 uses the
+// shared JWT secret; asymmetric algorithms load every key in JWT_KEY_DIR and
+// sign with JWT_ACTIVE_KEY_ID.
+func LoadKeySet(cfg *config.JWTConfig) (*KeySet, error) {
+	if cfg.Algorithm == "HS256" {
+		return &KeySet{secret: []byte(cfg.Secret)}, nil
+	}
+
+	keys, err := loadKeyDir(cfg.KeyDir)
+	if err != nil {
+		return nil, err
+	}
+
+	active, ok := keys[cfg.ActiveKeyID]
+	if !ok {
+		return nil, fmt.Errorf("active JWT key %q not found in %s", cfg.ActiveKeyID, cfg.KeyDir)
+	}
+	if active.private == nil {
+		return nil, fmt.Errorf("active JWT key %q has no private key", cfg.ActiveKeyID)
+	}
+	if active.method.Alg() != cfg.Algorithm {
+		return nil, fmt.Errorf("active JWT key %q is a %s key, expected %s",
+			cfg.ActiveKeyID, active.method.Alg(), cfg.Algorithm)
+	}
+
+	slog.Info("Loaded JWT keys", "count", len(keys), "dir", cfg.KeyDir, "active_kid", active.id, "algorithm", cfg.Algorithm)
+	return &KeySet{active: active, keys: keys}, nil
+}
+
+// loadKeyDir reads <kid>.pem private keys and <kid>.pub.pem public keys
+func loadKeyDir(dir string) (map[string]*signingKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key directory: %w", err)
+	}
+
+	keys := make(map[string]*signingKey)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".pem") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT key %s: %w", name, err)
+		}
+
+		var key *signingKey
+		if strings.HasSuffix(name, ".pub.pem") {
+			key, err = parsePublicKey(strings.TrimSuffix(name, ".pub.pem"), data)
+		} else {
+			key, err = parsePrivateKey(strings.TrimSuffix(name, ".pem"), data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT key %s: %w", name, err)
+		}
+
+		if _, exists := keys[key.id]; exists {
+			return nil, fmt.Errorf("duplicate JWT key ID %q", key.id)
+		}
+		keys[key.id] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no JWT keys found in %s", dir)
+	}
+
+	return keys, nil
+}
+
+func parsePrivateKey(id string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	key, err := newSigningKey(id, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.private = signer
+	return key, nil
+}
+
+func parsePublicKey(id string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSigningKey(id, parsed)
+}
+
+func newSigningKey(id string, public crypto.PublicKey) (*signingKey, error) {
+	key := &signingKey{id: id, public: public}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		key.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("only P-256 ECDSA keys are supported")
+		}
+		key.method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	return key, nil
+}
+
+// Sign creates a signed token for the claims with the active key
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if k.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+
+	token := jwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.id
+	return token.SignedString(k.active.private)
+}
+
+// Keyfunc resolves the verification key for a token from its kid header
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if k.active == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return k.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.public, nil
+}
+
+// JWKS returns the public keys that downstream services use to verify tokens.
+// Symmetric secrets are never published.
+func (k *KeySet) JWKS() models.JWKSResponse {
+	response := models.JWKSResponse{Keys: []models.JWK{}}
+
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := k.keys[id]
+		jwk := models.JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		response.Keys = append(response.Keys, jwk)
+	}
+
+	return response
+}
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"otp-auth-backend/config"
+	"otp-auth-backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func generateRSAKey(t *testing.T, bits int) crypto.Signer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	return key
+}
+
+func generateECKey(t *testing.T, curve elliptic.Curve) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %v", err)
+	}
+	return key
+}
+
+func generateEd25519Key(t *testing.T) crypto.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	return key
+}
+
+// writePrivateKey writes <kid>.pem in the encoding openssl produces for the key type
+func writePrivateKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	t.Helper()
+
+	var block *pem.Block
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			t.Fatalf("MarshalECPrivateKey: %v", err)
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+}
+
+// writePublicKey writes <kid>.pub.pem, as kept for a retired key
+func writePublicKey(t *testing.T, dir, kid string, key crypto.PublicKey) {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pub.pem"), data, 0o644); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+}
+
+func decodeJWKField(t *testing.T, value string) []byte {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatalf("JWK field %q is not base64url: %v", value, err)
+	}
+	return data
+}
+
+// publicKeyFromJWK rebuilds a public key from its JWK the way a downstream
+// service would, without access to the KeySet
+func publicKeyFromJWK(t *testing.T, jwk models.JWK) crypto.PublicKey {
+	t.Helper()
+
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(decodeJWKField(t, jwk.N)),
+			E: int(new(big.Int).SetBytes(decodeJWKField(t, jwk.E)).Int64()),
+		}
+	case "EC":
+		if jwk.Crv != "P-256" {
+			t.Fatalf("unexpected EC curve %q", jwk.Crv)
+		}
+		x, y := decodeJWKField(t, jwk.X), decodeJWKField(t, jwk.Y)
+		if len(x) != 32 || len(y) != 32 {
+			t.Fatalf("EC coordinates must be 32 bytes, got %d and %d", len(x), len(y))
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			t.Fatalf("unexpected OKP curve %q", jwk.Crv)
+		}
+		return ed25519.PublicKey(decodeJWKField(t, jwk.X))
+	}
+
+	t.Fatalf("unexpected key type %q", jwk.Kty)
+	return nil
+}
+
+// jwksKeyfunc verifies tokens using only the published key set
+func jwksKeyfunc(t *testing.T, published []byte) jwt.Keyfunc {
+	t.Helper()
+
+	var jwks models.JWKSResponse
+	if err := json.Unmarshal(published, &jwks); err != nil {
+		t.Fatalf("unmarshal JWKS: %v", err)
+	}
+
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, jwk := range jwks.Keys {
+			if jwk.Kid == kid && jwk.Alg == token.Method.Alg() {
+				return publicKeyFromJWK(t, jwk), nil
+			}
+		}
+		return nil, jwt.ErrTokenUnverifiable
+	}
+}
+
+func testClaims(subject string) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+}
+
+func TestKeySetRoundTripThroughJWKS(t *testing.T) {
+	tests := []struct {
+		alg     string
+		kty     string
+		crv     string
+		newKey  func(t *testing.T) crypto.Signer
+		keySize int
+	}{
+		{"RS256", "RSA", "", func(t *testing.T) crypto.Signer { return generateRSAKey(t, 2048) }, 0},
+		{"ES256", "EC", "P-256", func(t *testing.T) crypto.Signer { return generateECKey(t, elliptic.P256()) }, 32},
+		{"EdDSA", "OKP", "Ed25519", generateEd25519Key, 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			dir := t.TempDir()
+			writePrivateKey(t, dir, "current", tt.newKey(t))
+
+			keySet, err := LoadKeySet(&config.JWTConfig{Algorithm: tt.alg, KeyDir: dir, ActiveKeyID: "current"})
+			if err != nil {
+				t.Fatalf("LoadKeySet: %v", err)
+			}
+
+			signed, err := keySet.Sign(testClaims("user-1"))
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+
+			jwks := keySet.JWKS()
+			if len(jwks.Keys) != 1 {
+				t.Fatalf("JWKS has %d keys, want 1", len(jwks.Keys))
+			}
+			jwk := jwks.Keys[0]
+			if jwk.Kid != "current" || jwk.Alg != tt.alg || jwk.Kty != tt.kty || jwk.Crv != tt.crv || jwk.Use != "sig" {
+				t.Errorf("unexpected JWK %+v", jwk)
+			}
+			if tt.keySize > 0 && len(decodeJWKField(t, jwk.X)) != tt.keySize {
+				t.Errorf("x is %d bytes, want %d", len(decodeJWKField(t, jwk.X)), tt.keySize)
+			}
+
+			published, err := json.Marshal(jwks)
+			if err != nil {
+				t.Fatalf("marshal JWKS: %v", err)
+			}
+			if strings.Contains(string(published), `"d"`) {
+				t.Errorf("JWKS contains private key material: %s", published)
+			}
+
+			claims := &jwt.RegisteredClaims{}
+			token, err := jwt.ParseWithClaims(signed, claims, jwksKeyfunc(t, published), jwt.WithValidMethods([]string{tt.alg}))
+			if err != nil || !token.Valid {
+				t.Fatalf("token does not verify against the JWKS: %v", err)
+			}
+			if claims.Subject != "user-1" {
+				t.Errorf("subject = %q, want user-1", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestKeySetVerifiesRetiredKeys(t *testing.T) {
+	dir := t.TempDir()
+	retired := generateECKey(t, elliptic.P256())
+	writePrivateKey(t, dir, "2025", generateECKey(t, elliptic.P256()))
+	writePublicKey(t, dir, "2024", retired.Public())
+
+	keySet, err := LoadKeySet(&config.JWTConfig{Algorithm: "ES256", KeyDir: dir, ActiveKeyID: "2025"})
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	// A token issued before the rotation
+	old := jwt.NewWithClaims(jwt.SigningMethodES256, testClaims("user-1"))
+	old.Header["kid"] = "2024"
+	signed, err := old.SignedString(retired)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if _, err := jwt.Parse(signed, keySet.Keyfunc); err != nil {
+		t.Errorf("token signed with the retired key does not verify: %v", err)
+	}
+
+	jwks := keySet.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "2024" || jwks.Keys[1].Kid != "2025" {
+		t.Errorf("JWKS keys = %+v, want 2024 and 2025", jwks.Keys)
+	}
+
+	// New tokens are signed with the active key
+	current, err := keySet.Sign(testClaims("user-1"))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(current, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if token.Header["kid"] != "2025" {
+		t.Errorf("kid = %v, want 2025", token.Header["kid"])
+	}
+}
+
+func TestKeySetKeyfuncRejects(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := generateRSAKey(t, 2048)
+	edKey := generateEd25519Key(t)
+	writePrivateKey(t, dir, "rsa", rsaKey)
+	writePrivateKey(t, dir, "ed", edKey)
+
+	keySet, err := LoadKeySet(&config.JWTConfig{Algorithm: "RS256", KeyDir: dir, ActiveKeyID: "rsa"})
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, testClaims("user-1"))
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return signed
+	}
+
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown kid", sign(jwt.SigningMethodRS256, "other", generateRSAKey(t, 2048))},
+		{"missing kid", sign(jwt.SigningMethodRS256, "", rsaKey)},
+		{"HS256 with the RSA public key as secret", sign(jwt.SigningMethodHS256, "rsa", rsaPublicDER)},
+		{"RS256 under the EdDSA kid", sign(jwt.SigningMethodRS256, "ed", rsaKey)},
+		{"EdDSA under the RSA kid", sign(jwt.SigningMethodEdDSA, "rsa", edKey)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := jwt.Parse(tt.token, keySet.Keyfunc); err == nil {
+				t.Error("token was accepted")
+			}
+		})
+	}
+}
+
+func TestKeySetHS256(t *testing.T) {
+	keySet, err := LoadKeySet(&config.JWTConfig{Algorithm: "HS256", Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	signed, err := keySet.Sign(testClaims("user-1"))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := jwt.Parse(signed, keySet.Keyfunc); err != nil {
+		t.Errorf("HS256 token does not verify: %v", err)
+	}
+
+	// The shared secret is never published
+	if keys := keySet.JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS has %d keys, want none", len(keys))
+	}
+
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, testClaims("user-1")).SignedString(generateEd25519Key(t))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := jwt.Parse(forged, keySet.Keyfunc); err == nil {
+		t.Error("EdDSA token accepted by an HS256 key set")
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		setup     func(t *testing.T, dir string)
+		wantErr   string
+	}{
+		{
+			name:      "empty directory",
+			algorithm: "ES256",
+			setup:     func(t *testing.T, dir string) {},
+			wantErr:   "no JWT keys found",
+		},
+		{
+			name:      "active key missing",
+			algorithm: "ES256",
+			setup: func(t *testing.T, dir string) {
+				writePrivateKey(t, dir, "other", generateECKey(t, elliptic.P256()))
+			},
+			wantErr: "not found",
+		},
+		{
+			name:      "active key is public only",
+			algorithm: "ES256",
+			setup: func(t *testing.T, dir string) {
+				writePublicKey(t, dir, "active", generateECKey(t, elliptic.P256()).Public())
+			},
+			wantErr: "has no private key",
+		},
+		{
+			name:      "algorithm does not match the key",
+			algorithm: "RS256",
+			setup: func(t *testing.T, dir string) {
+				writePrivateKey(t, dir, "active", generateECKey(t, elliptic.P256()))
+			},
+			wantErr: "is a ES256 key, expected RS256",
+		},
+		{
+			name:      "RSA key too small",
+			algorithm: "RS256",
+			setup: func(t *testing.T, dir string) {
+				writePrivateKey(t, dir, "active", generateRSAKey(t, 1024))
+			},
+			wantErr: "at least 2048 bits",
+		},
+		{
+			name:      "unsupported curve",
+			algorithm: "ES256",
+			setup: func(t *testing.T, dir string) {
+				writePrivateKey(t, dir, "active", generateECKey(t, elliptic.P384()))
+			},
+			wantErr: "only P-256",
+		},
+		{
+			name:      "duplicate kid",
+			algorithm: "ES256",
+			setup: func(t *testing.T, dir string) {
+				key := generateECKey(t, elliptic.P256())
+				writePrivateKey(t, dir, "active", key)
+				writePublicKey(t, dir, "active", key.Public())
+			},
+			wantErr: "duplicate JWT key ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+
+			_, err := LoadKeySet(&config.JWTConfig{Algorithm: tt.algorithm, KeyDir: dir, ActiveKeyID: "active"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadKeySet error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
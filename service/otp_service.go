@@ -2,106 +2,529 @@ package service
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"math"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"otp-auth-backend/config"
+	"otp-auth-backend/logging"
+	"otp-auth-backend/metrics"
 	"otp-auth-backend/models"
+	"otp-auth-backend/phone"
+	"otp-auth-backend/sender"
 	"otp-auth-backend/store"
 )
 
 type OTPService struct {
 	redisStore *store.RedisStore
+	sender     sender.Sender
 	config     *config.Config
 }
 
-func NewOTPService(redisStore *store.RedisStore, config *config.Config) *OTPService {
+func NewOTPService(redisStore *store.RedisStore, otpSender sender.Sender, config *config.Config) *OTPService {
 	return &OTPService{
 		redisStore: redisStore,
+		sender:     otpSender,
 		config:     config,
 	}
 }
 
+// otpAlphabets maps the configured alphabet name to its characters. The
+// alphanumeric set leaves out 0/O, 1/I/L and similar look-alikes.
+var otpAlphabets = map[string]string{
+	config.OTPAlphabetNumeric:      "0123456789",
+	config.OTPAlphabetAlphanumeric: "23456789ABCDEFGHJKMNPQRSTUVWXYZ",
+	config.OTPAlphabetHex:          "0123456789ABCDEF",
+}
+
 func (s *OTPService) GenerateOTP() (string, error) {
-	// Generate a random 6-digit OTP
-	max := big.NewInt(1000000) // 10^6
-	n, err := rand.Int(rand.Reader, max)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate random number: %w", err)
+	alphabet := otpAlphabets[s.config.OTP.Alphabet]
+	max := big.NewInt(int64(len(alphabet)))
+
+	// Pick each character uniformly from the configured alphabet
+	otp := make([]byte, s.config.OTP.Length)
+	for i := range otp {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random number: %w", err)
+		}
+		otp[i] = alphabet[n.Int64()]
+	}
+
+	return string(otp), nil
+}
+
+// NormalizeOTP canonicalizes user input and checks it against the configured
+// length and alphabet
+func (s *OTPService) NormalizeOTP(otp string) (string, error) {
+	otp = strings.ToUpper(strings.TrimSpace(otp))
+
+	if len(otp) != s.config.OTP.Length {
+		return "", &MalformedOTPError{
+			Reason: fmt.Sprintf("OTP must be %d characters long", s.config.OTP.Length),
+		}
+	}
+
+	alphabet := otpAlphabets[s.config.OTP.Alphabet]
+	for _, ch := range otp {
+		if !strings.ContainsRune(alphabet, ch) {
+			return "", &MalformedOTPError{Reason: "OTP contains invalid characters"}
+		}
 	}
 
-	// Format as 6-digit string with leading zeros
-	otp := fmt.Sprintf("%06d", n.Int64())
 	return otp, nil
 }
 
+// NormalizePhone converts user input to E.164 and rejects numbers that
+// cannot receive an SMS
+func (s *OTPService) NormalizePhone(raw string) (string, error) {
+	normalized, err := phone.NormalizeMobile(raw, s.config.Phone.DefaultRegion)
+	if err != nil {
+		return "", &InvalidPhoneError{Reason: err.Error()}
+	}
+	return normalized, nil
+}
+
+// OTPPurpose separates codes issued for different flows, so that a code sent
+// to log in cannot confirm a phone change and the other way round
+type OTPPurpose string
+
+const (
+	OTPPurposeLogin       OTPPurpose = "login"
+	OTPPurposeChangePhone OTPPurpose = "change_phone"
+)
+
+// otpMessages is the SMS text per purpose, formatted with the code and its lifetime
+var otpMessages = map[OTPPurpose]string{
+	OTPPurposeLogin:       "Your verification code is %s. It expires in %v.",
+	OTPPurposeChangePhone: "Your code to confirm this number for your account is %s. It expires in %v.",
+}
+
+// otpSubject returns the identifier a code is stored under. Login codes are
+// keyed by phone alone; codes for other purposes also belong to one user.
+func otpSubject(purpose OTPPurpose, userID, phone string) string {
+	if purpose == OTPPurposeLogin {
+		return phone
+	}
+	return string(purpose) + ":" + userID + ":" + phone
+}
+
+// RequestOTP sends a login code to phone
 func (s *OTPService) RequestOTP(ctx context.Context, phone string) (*models.RequestOTPResponse, error) {
-	// Check rate limiting
-	count, err := s.redisStore.IncrementRateLimit(ctx, phone, s.config.RateLimit.Window)
+	return s.RequestOTPForPurpose(ctx, OTPPurposeLogin, "", phone)
+}
+
+// RequestOTPForPurpose sends a code for purpose to phone. For purposes other
+// than login the code is only valid for the given user.
+func (s *OTPService) RequestOTPForPurpose(ctx context.Context, purpose OTPPurpose, userID, phone string) (*models.RequestOTPResponse, error) {
+	phone, err := s.NormalizePhone(phone)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+		return nil, err
+	}
+	return s.requestOTP(ctx, purpose, userID, phone)
+}
+
+// RequestOTPForStoredPhone is like RequestOTPForPurpose for a phone read from
+// the user's record. It is used as stored, so accounts whose phone predates
+// normalization are not locked out of flows that verify it.
+func (s *OTPService) RequestOTPForStoredPhone(ctx context.Context, purpose OTPPurpose, userID, phone string) (*models.RequestOTPResponse, error) {
+	return s.requestOTP(ctx, purpose, userID, phone)
+}
+
+func (s *OTPService) requestOTP(ctx context.Context, purpose OTPPurpose, userID, phone string) (*models.RequestOTPResponse, error) {
+	subject := otpSubject(purpose, userID, phone)
+
+	// A locked out phone cannot receive new codes until the lockout expires
+	if err := s.checkLockout(ctx, subject, phone); err != nil {
+		return nil, err
 	}
 
-	if count > int64(s.config.RateLimit.MaxRequests) {
-		return nil, &RateLimitExceededError{
-			Phone:       phone,
-			MaxRequests: s.config.RateLimit.MaxRequests,
-			Window:      s.config.RateLimit.Window,
+	// Enforce the minimum interval between two sends to the same phone
+	cooldown := s.config.OTP.ResendCooldown
+	if cooldown > 0 {
+		acquired, remaining, err := s.redisStore.AcquireOTPResendSlot(ctx, subject, cooldown)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check OTP resend cooldown: %w", err)
+		}
+		if !acquired {
+			return nil, &ResendCooldownError{Phone: phone, RetryAfter: remaining}
 		}
 	}
 
-	// Generate OTP
-	otp, err := s.GenerateOTP()
+	// Cap the codes sent to the phone for any purpose, independently of the
+	// rate limit middleware, which can be disabled
+	limit, err := s.redisStore.AllowRate(ctx, "otp_send:"+phone, s.config.OTP.SendLimit, s.config.OTP.SendWindow)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate OTP: %w", err)
+		s.releaseResendSlot(ctx, subject)
+		return nil, fmt.Errorf("failed to check OTP send limit: %w", err)
+	}
+	if !limit.Allowed {
+		s.releaseResendSlot(ctx, subject)
+		return nil, &SendLimitError{Phone: phone, RetryAfter: limit.RetryAfter}
 	}
 
-	// Store OTP in Redis with expiration
-	err = s.redisStore.SetOTP(ctx, phone, otp, s.config.OTP.Expiration)
+	otp, expiresIn, reused, err := s.issueOTP(ctx, subject)
 	if err != nil {
-		return nil, fmt.Errorf("failed to store OTP: %w", err)
+		s.releaseResendSlot(ctx, subject)
+		return nil, err
 	}
 
-	// Print OTP to console (explicit requirement)
-	log.Printf("OTP for phone %s: %s (expires in %v)", phone, otp, s.config.OTP.Expiration)
+	// Deliver OTP through the configured sender
+	msg := &sender.Message{
+		Phone: phone,
+		Body:  fmt.Sprintf(otpMessages[purpose], otp, expiresIn.Round(time.Second)),
+		Metadata: map[string]string{
+			"otp":        otp,
+			"expires_in": fmt.Sprintf("%d", int(expiresIn.Seconds())),
+		},
+	}
+	if err := s.sender.Send(ctx, msg); err != nil {
+		// Drop an undelivered new code so it cannot be guessed while the user
+		// retries. A reused code was already delivered once and stays valid.
+		if !reused {
+			if delErr := s.redisStore.DeleteOTP(ctx, subject); delErr != nil {
+				logging.FromContext(ctx).Warn("Failed to delete undelivered OTP", "phone", phone, "error", delErr)
+			}
+		}
+		s.releaseResendSlot(ctx, subject)
+		metrics.OTPDeliveryFailures.WithLabelValues(s.sender.Name()).Inc()
+		return nil, &DeliveryFailedError{Phone: phone, Provider: s.sender.Name(), Err: err}
+	}
+	metrics.OTPSent.WithLabelValues(s.sender.Name(), strconv.FormatBool(reused)).Inc()
 
 	return &models.RequestOTPResponse{
-		Message: "OTP sent successfully",
-		Phone:   phone,
+		Message:           "OTP sent successfully",
+		Phone:             phone,
+		ExpiresIn:         int(expiresIn.Seconds()),
+		ResendAvailableIn: int(math.Ceil(cooldown.Seconds())),
 	}, nil
 }
 
-func (s *OTPService) VerifyOTP(ctx context.Context, phone, otp string) (string, error) {
-	// Get stored OTP
-	storedOTP, err := s.redisStore.GetOTP(ctx, phone)
+// issueOTP returns the code to send and how long it stays valid. With
+// ReuseOnResend the current code is sent again as long as it outlives the
+// resend cooldown, keeping its expiry and attempt counter; otherwise a new
+// code replaces it.
+func (s *OTPService) issueOTP(ctx context.Context, subject string) (string, time.Duration, bool, error) {
+	if s.config.OTP.ReuseOnResend {
+		sealed, ttl, err := s.redisStore.GetResendableOTP(ctx, subject)
+		if err != nil {
+			return "", 0, false, fmt.Errorf("failed to load current OTP: %w", err)
+		}
+
+		if sealed != "" && ttl > s.config.OTP.ResendCooldown {
+			otp, err := s.openOTP(subject, sealed)
+			if err == nil {
+				return otp, ttl, true, nil
+			}
+			// A code sealed with a previous pepper cannot be recovered; replace it
+			logging.FromContext(ctx).Warn("Failed to reuse OTP", "subject", subject, "error", err)
+		}
+	}
+
+	// Generate OTP
+	otp, err := s.GenerateOTP()
 	if err != nil {
-		return "", fmt.Errorf("OTP not found or expired: %w", err)
+		return "", 0, false, fmt.Errorf("failed to generate OTP: %w", err)
 	}
 
-	// Verify OTP
-	if storedOTP != otp {
-		return "", fmt.Errorf("invalid OTP")
+	var sealed string
+	if s.config.OTP.ReuseOnResend {
+		sealed, err = s.sealOTP(subject, otp)
+		if err != nil {
+			return "", 0, false, fmt.Errorf("failed to seal OTP: %w", err)
+		}
 	}
 
-	// Delete OTP after successful verification to prevent replay attacks
-	err = s.redisStore.DeleteOTP(ctx, phone)
+	// Store only the keyed hash of the OTP in Redis with expiration
+	err = s.redisStore.SetOTP(ctx, subject, s.hashOTP(subject, otp), sealed, s.config.OTP.Expiration)
 	if err != nil {
-		log.Printf("Warning: failed to delete OTP for %s: %v", phone, err)
+		return "", 0, false, fmt.Errorf("failed to store OTP: %w", err)
+	}
+
+	return otp, s.config.OTP.Expiration, false, nil
+}
+
+func (s *OTPService) releaseResendSlot(ctx context.Context, subject string) {
+	if s.config.OTP.ResendCooldown <= 0 {
+		return
+	}
+
+	// Let the user retry right away when nothing was delivered
+	if err := s.redisStore.ReleaseOTPResendSlot(ctx, subject); err != nil {
+		logging.FromContext(ctx).Warn("Failed to reset OTP resend cooldown", "subject", subject, "error", err)
 	}
+}
+
+// VerifyOTP checks and consumes a login code
+func (s *OTPService) VerifyOTP(ctx context.Context, phone, otp string) error {
+	return s.VerifyOTPForPurpose(ctx, OTPPurposeLogin, "", phone, otp)
+}
+
+// VerifyOTPForPurpose checks and consumes a code sent with RequestOTPForPurpose
+func (s *OTPService) VerifyOTPForPurpose(ctx context.Context, purpose OTPPurpose, userID, phone, otp string) error {
+	phone, err := s.NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+	return s.verifyOTP(ctx, purpose, userID, phone, otp)
+}
+
+// VerifyOTPForStoredPhone checks and consumes a code sent with
+// RequestOTPForStoredPhone
+func (s *OTPService) VerifyOTPForStoredPhone(ctx context.Context, purpose OTPPurpose, userID, phone, otp string) error {
+	return s.verifyOTP(ctx, purpose, userID, phone, otp)
+}
+
+func (s *OTPService) verifyOTP(ctx context.Context, purpose OTPPurpose, userID, phone, otp string) error {
+	subject := otpSubject(purpose, userID, phone)
+
+	// Reject malformed codes without spending an attempt
+	otp, err := s.NormalizeOTP(otp)
+	if err != nil {
+		return err
+	}
+
+	// Refuse verification while the phone is locked out
+	if err := s.checkLockout(ctx, subject, phone); err != nil {
+		var lockedErr *OTPLockedError
+		if errors.As(err, &lockedErr) {
+			metrics.OTPVerifications.WithLabelValues(metrics.VerifyResultLocked).Inc()
+		}
+		return err
+	}
+
+	// Compare and consume atomically so concurrent requests cannot both succeed
+	candidates := []string{s.hashOTP(subject, otp)}
+	if s.config.OTP.AcceptPlaintext && purpose == OTPPurposeLogin {
+		// Codes written by releases that stored plaintext are still accepted during rollout
+		candidates = append(candidates, otp)
+	}
+
+	result, attempts, err := s.redisStore.VerifyAndConsumeOTP(ctx, subject, s.config.OTP.MaxRetries, s.config.OTP.LockoutWindow, candidates...)
+	if err != nil {
+		return fmt.Errorf("failed to verify OTP: %w", err)
+	}
+
+	switch result {
+	case store.OTPCheckNotFound:
+		metrics.OTPVerifications.WithLabelValues(metrics.VerifyResultExpired).Inc()
+		return ErrOTPNotFound
+	case store.OTPCheckMismatch:
+		metrics.OTPVerifications.WithLabelValues(metrics.VerifyResultFailed).Inc()
+		return &InvalidOTPError{Phone: phone, RemainingAttempts: s.config.OTP.MaxRetries - int(attempts)}
+	case store.OTPCheckExhausted:
+		metrics.OTPVerifications.WithLabelValues(metrics.VerifyResultLocked).Inc()
+		return s.lockOut(ctx, subject, phone)
+	}
+	metrics.OTPVerifications.WithLabelValues(metrics.VerifyResultVerified).Inc()
+
+	// A successful login clears the lockout escalation history
+	if err := s.redisStore.ResetOTPBurns(ctx, subject); err != nil {
+		logging.FromContext(ctx).Warn("Failed to reset OTP lockout history", "phone", phone, "error", err)
+	}
+
+	return nil
+}
+
+// otpHashPrefix marks stored values that are keyed hashes rather than legacy plaintext codes
+const otpHashPrefix = "h1:"
+
+// hashOTP derives the value stored in Redis for a code. The subject is part
+// of the MAC so a stored hash cannot be replayed against another number or
+// purpose. Login subjects are the bare phone, as in earlier releases.
+func (s *OTPService) hashOTP(subject, otp string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.OTP.Pepper))
+	mac.Write([]byte(subject))
+	mac.Write([]byte{0})
+	mac.Write([]byte(otp))
+	return otpHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// resendCipher derives an AES-256-GCM cipher from the pepper for the copy of
+// the code that is kept for resending
+func (s *OTPService) resendCipher() (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(s.config.OTP.Pepper))
+	mac.Write([]byte("otp-resend-key"))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealOTP encrypts a code for storage. The subject is bound as additional
+// data so a sealed code cannot be moved to another number or purpose.
+func (s *OTPService) sealOTP(subject, otp string) (string, error) {
+	aead, err := s.resendCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(otp), []byte(subject))
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *OTPService) openOTP(subject, sealed string) (string, error) {
+	aead, err := s.resendCipher()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("sealed OTP is too short")
+	}
+
+	otp, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(subject))
+	if err != nil {
+		return "", err
+	}
+
+	return string(otp), nil
+}
+
+// checkLockout returns an OTPLockedError if the subject is currently locked out
+func (s *OTPService) checkLockout(ctx context.Context, subject, phone string) error {
+	remaining, err := s.redisStore.GetOTPLockout(ctx, subject)
+	if err != nil {
+		return fmt.Errorf("failed to check OTP lockout: %w", err)
+	}
+
+	if remaining > 0 {
+		return &OTPLockedError{Phone: phone, RetryAfter: remaining}
+	}
+
+	return nil
+}
+
+// lockOut locks the phone out after a code was burned by too many wrong
+// guesses, doubling the lockout for every code burned within the lockout window
+func (s *OTPService) lockOut(ctx context.Context, subject, phone string) error {
+	burns, err := s.redisStore.IncrementOTPBurns(ctx, subject, s.config.OTP.LockoutWindow)
+	if err != nil {
+		return fmt.Errorf("failed to record OTP lockout: %w", err)
+	}
+
+	lockout := s.lockoutDuration(burns)
+	if err := s.redisStore.SetOTPLockout(ctx, subject, lockout); err != nil {
+		return fmt.Errorf("failed to lock out phone: %w", err)
+	}
+
+	logging.FromContext(ctx).Warn("Phone locked out after burned OTPs",
+		"phone", phone, "lockout", lockout.String(), "burned_otps", burns)
+	metrics.OTPLockouts.Inc()
+
+	return &OTPLockedError{Phone: phone, RetryAfter: lockout}
+}
+
+func (s *OTPService) lockoutDuration(burns int64) time.Duration {
+	lockout := s.config.OTP.LockoutBase
+	for i := int64(1); i < burns; i++ {
+		lockout *= 2
+		if lockout >= s.config.OTP.LockoutMax {
+			return s.config.OTP.LockoutMax
+		}
+	}
+
+	if lockout > s.config.OTP.LockoutMax {
+		return s.config.OTP.LockoutMax
+	}
+
+	return lockout
+}
+
+var ErrOTPNotFound = errors.New("OTP not found or expired")
+
+type DeliveryFailedError struct {
+	Phone    string
+	Provider string
+	Err      error
+}
+
+func (e *DeliveryFailedError) Error() string {
+	return fmt.Sprintf("failed to deliver OTP to %s via %s: %v", e.Phone, e.Provider, e.Err)
+}
+
+func (e *DeliveryFailedError) Unwrap() error {
+	return e.Err
+}
+
+type InvalidOTPError struct {
+	Phone             string
+	RemainingAttempts int
+}
+
+func (e *InvalidOTPError) Error() string {
+	return fmt.Sprintf("invalid OTP: %d attempts remaining", e.RemainingAttempts)
+}
+
+type OTPLockedError struct {
+	Phone      string
+	RetryAfter time.Duration
+}
+
+func (e *OTPLockedError) Error() string {
+	return fmt.Sprintf("too many failed OTP attempts for phone %s: locked for %v",
+		e.Phone, e.RetryAfter.Round(time.Second))
+}
+
+type ResendCooldownError struct {
+	Phone      string
+	RetryAfter time.Duration
+}
+
+func (e *ResendCooldownError) Error() string {
+	return fmt.Sprintf("OTP for phone %s was sent recently: retry in %v",
+		e.Phone, e.RetryAfter.Round(time.Second))
+}
+
+// SendLimitError is returned when a phone has been sent OTP_SEND_LIMIT codes
+// within OTP_SEND_WINDOW
+type SendLimitError struct {
+	Phone      string
+	RetryAfter time.Duration
+}
+
+func (e *SendLimitError) Error() string {
+	return fmt.Sprintf("too many OTPs sent to phone %s: retry in %v",
+		e.Phone, e.RetryAfter.Round(time.Second))
+}
+
+// InvalidPhoneError is returned for phone numbers that cannot be normalized
+// to a mobile number in E.164
+type InvalidPhoneError struct {
+	Reason string
+}
 
-	return storedOTP, nil
+func (e *InvalidPhoneError) Error() string {
+	return e.Reason
 }
 
-type RateLimitExceededError struct {
-	Phone       string
-	MaxRequests int
-	Window      time.Duration
+type MalformedOTPError struct {
+	Reason string
 }
 
-func (e *RateLimitExceededError) Error() string {
-	return fmt.Sprintf("rate limit exceeded for phone %s: max %d requests per %v",
-		e.Phone, e.MaxRequests, e.Window)
+func (e *MalformedOTPError) Error() string {
+	return e.Reason
 }
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"otp-auth-backend/config"
+	"otp-auth-backend/sender"
+	"otp-auth-backend/store"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// recordingSender keeps the messages it is asked to deliver
+type recordingSender struct {
+	mu       sync.Mutex
+	messages []*sender.Message
+}
+
+func (s *recordingSender) Name() string {
+	return "recording"
+}
+
+func (s *recordingSender) Send(ctx context.Context, msg *sender.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *recordingSender) sent() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages)
+}
+
+func newTestOTPService(t *testing.T) *OTPService {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	redisStore, err := store.NewRedisStore(&config.RedisConfig{Host: mr.Host(), Port: mr.Port(), PoolSize: 64})
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { redisStore.Close() })
+
+	cfg := &config.Config{
+		OTP: config.OTPConfig{
+			Length:        6,
+			Alphabet:      config.OTPAlphabetNumeric,
+			Pepper:        "test-pepper",
+			Expiration:    time.Minute,
+			MaxRetries:    3,
+			LockoutBase:   time.Minute,
+			LockoutMax:    time.Hour,
+			LockoutWindow: time.Hour,
+			SendLimit:     10,
+			SendWindow:    time.Hour,
+		},
+		Phone: config.PhoneConfig{DefaultRegion: "US"},
+	}
+
+	return NewOTPService(redisStore, &recordingSender{}, cfg)
+}
+
+func TestVerifyOTPConcurrentOnlyOneWins(t *testing.T) {
+	s := newTestOTPService(t)
+	ctx := context.Background()
+	const phone, code, verifiers = "+12015550123", "123456", 50
+
+	if err := s.redisStore.SetOTP(ctx, phone, s.hashOTP(phone, code), "", time.Minute); err != nil {
+		t.Fatalf("SetOTP: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, verifiers)
+	for i := 0; i < verifiers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- s.VerifyOTP(ctx, phone, code)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	var succeeded, notFound int
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrOTPNotFound):
+			notFound++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if succeeded != 1 {
+		t.Errorf("%d verifications succeeded, want exactly 1", succeeded)
+	}
+	if notFound != verifiers-1 {
+		t.Errorf("%d verifications found no code, want %d", notFound, verifiers-1)
+	}
+
+	// Losing the race is not a wrong guess: the phone must not be locked out
+	if err := s.checkLockout(ctx, phone, phone); err != nil {
+		t.Errorf("phone locked out after a successful verification: %v", err)
+	}
+}
+
+func TestVerifyOTPPlaintextFallback(t *testing.T) {
+	tests := []struct {
+		name            string
+		acceptPlaintext bool
+		wantErr         bool
+	}{
+		{"accepted during rollout", true, false},
+		{"rejected by default", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestOTPService(t)
+			s.config.OTP.AcceptPlaintext = tt.acceptPlaintext
+			ctx := context.Background()
+			const phone, code = "+12015550123", "654321"
+
+			// Codes written by releases that stored plaintext
+			if err := s.redisStore.SetOTP(ctx, phone, code, "", time.Minute); err != nil {
+				t.Fatalf("SetOTP: %v", err)
+			}
+
+			err := s.VerifyOTP(ctx, phone, code)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("VerifyOTP error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestOTPSendLimit(t *testing.T) {
+	s := newTestOTPService(t)
+	s.config.OTP.SendLimit = 2
+	ctx := context.Background()
+	const phone = "+12015550123"
+
+	// Login and phone change codes share the budget of the receiving phone
+	if _, err := s.RequestOTP(ctx, phone); err != nil {
+		t.Fatalf("RequestOTP: %v", err)
+	}
+	if _, err := s.RequestOTPForPurpose(ctx, OTPPurposeChangePhone, "user-1", phone); err != nil {
+		t.Fatalf("RequestOTPForPurpose: %v", err)
+	}
+
+	_, err := s.RequestOTP(ctx, phone)
+	var limitErr *SendLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("RequestOTP error = %v, want SendLimitError", err)
+	}
+	if limitErr.RetryAfter <= 0 {
+		t.Errorf("RetryAfter = %v, want positive", limitErr.RetryAfter)
+	}
+
+	if sent := s.sender.(*recordingSender).sent(); sent != 2 {
+		t.Errorf("%d messages sent, want 2", sent)
+	}
+
+	// Other phones have their own budget
+	if _, err := s.RequestOTP(ctx, "+12015550124"); err != nil {
+		t.Errorf("RequestOTP for another phone: %v", err)
+	}
+}
+
+func TestStoredPhoneOTPRoundTrip(t *testing.T) {
+	s := newTestOTPService(t)
+	ctx := context.Background()
+
+	// Phones kept from before normalization, or moved aside as duplicates,
+	// are used as stored rather than as the number they parse to
+	for _, stored := range []string{"(201) 555-0123", "dup:+12015550123"} {
+		t.Run(stored, func(t *testing.T) {
+			if _, err := s.RequestOTPForStoredPhone(ctx, OTPPurposeChangePhone, "user-1", stored); err != nil {
+				t.Fatalf("RequestOTPForStoredPhone: %v", err)
+			}
+
+			rs := s.sender.(*recordingSender)
+			rs.mu.Lock()
+			msg := rs.messages[len(rs.messages)-1]
+			rs.mu.Unlock()
+			if msg.Phone != stored {
+				t.Errorf("code sent to %q, want %q", msg.Phone, stored)
+			}
+
+			if err := s.VerifyOTPForStoredPhone(ctx, OTPPurposeChangePhone, "user-1", stored, msg.Metadata["otp"]); err != nil {
+				t.Errorf("VerifyOTPForStoredPhone: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"otp-auth-backend/logging"
+	"otp-auth-backend/metrics"
+	"otp-auth-backend/models"
+	"otp-auth-backend/store"
+)
+
+var (
+	ErrPhoneInUse     = errors.New("phone number is already registered to another account")
+	ErrPhoneUnchanged = errors.New("phone number is already the account's phone")
+)
+
+// OldPhoneOTPError wraps a failed verification of the code sent to the
+// current number during a phone change
+type OldPhoneOTPError struct {
+	Err error
+}
+
+func (e *OldPhoneOTPError) Error() string {
+	return "current phone verification failed: " + e.Err.Error()
+}
+
+func (e *OldPhoneOTPError) Unwrap() error {
+	return e.Err
+}
+
+// RequestPhoneChange sends a confirmation code to the new phone and, when
+// PHONE_CHANGE_VERIFY_OLD is set, another one to the user's current phone.
+// The codes are only valid for this user and this change.
+func (s *AuthService) RequestPhoneChange(ctx context.Context, userID, newPhone string) (*models.ChangePhoneResponse, error) {
+	user, phone, err := s.phoneChangeTarget(ctx, userID, newPhone)
+	if err != nil {
+		return nil, err
+	}
+
+	verifyOld := s.config.Phone.ChangeVerifyOld
+	if verifyOld {
+		if _, err := s.otpService.RequestOTPForStoredPhone(ctx, OTPPurposeChangePhone, userID, user.Phone); err != nil {
+			return nil, err
+		}
+	}
+
+	sent, err := s.otpService.RequestOTPForPurpose(ctx, OTPPurposeChangePhone, userID, phone)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ChangePhoneResponse{
+		Message:                      "Confirmation code sent",
+		Phone:                        sent.Phone,
+		ExpiresIn:                    sent.ExpiresIn,
+		ResendAvailableIn:            sent.ResendAvailableIn,
+		OldPhoneVerificationRequired: verifyOld,
+	}, nil
+}
+
+// ConfirmPhoneChange verifies the codes sent by RequestPhoneChange and moves
+// the user to the new phone. Every existing session is revoked since it was
+// authenticated with the old number; the caller gets a new session instead.
+func (s *AuthService) ConfirmPhoneChange(ctx context.Context, userID string, req *models.VerifyPhoneChangeRequest, client models.ClientInfo) (*models.VerifyOTPResponse, error) {
+	user, phone, err := s.phoneChangeTarget(ctx, userID, req.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	verifyOld := s.config.Phone.ChangeVerifyOld
+	if verifyOld && req.OldOTP == "" {
+		return nil, &MalformedOTPError{Reason: "old_otp is required to change the phone number"}
+	}
+
+	// Proof of the current number comes first, so a stolen session cannot
+	// burn or brute force the new number's code without it
+	if verifyOld {
+		if err := s.otpService.VerifyOTPForStoredPhone(ctx, OTPPurposeChangePhone, userID, user.Phone, req.OldOTP); err != nil {
+			return nil, &OldPhoneOTPError{Err: err}
+		}
+	}
+
+	if err := s.otpService.VerifyOTPForPurpose(ctx, OTPPurposeChangePhone, userID, phone, req.OTP); err != nil {
+		return nil, fmt.Errorf("OTP verification failed: %w", err)
+	}
+
+	updated, err := s.userRepo.UpdatePhone(ctx, user.ID, phone)
+	if errors.Is(err, store.ErrPhoneTaken) {
+		return nil, ErrPhoneInUse
+	}
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if err := s.LogoutAll(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.startSession(ctx, updated, req.DeviceLabel, client)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.TokensIssued.WithLabelValues(metrics.GrantOTP).Inc()
+	recordAudit(ctx, s.auditRepo, models.NewAuditEvent(user.ID, models.AuditEventPhoneChanged, client, nil))
+	logging.FromContext(ctx).Info("Changed phone number", "user_id", userID)
+
+	return &models.VerifyOTPResponse{
+		Message:      "Phone number changed",
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         updated.ToResponse(),
+	}, nil
+}
+
+// phoneChangeTarget loads the user and normalizes the requested phone,
+// rejecting a change to the number the user already has or one registered to
+// another account, before any code is spent on it
+func (s *AuthService) phoneChangeTarget(ctx context.Context, userID, newPhone string) (*models.User, string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, "", ErrUserNotFound
+	}
+
+	phone, err := s.otpService.NormalizePhone(newPhone)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if phone == user.Phone {
+		return nil, "", ErrPhoneUnchanged
+	}
+
+	// UpdatePhone still decides races between users claiming the number
+	owner, err := s.userRepo.GetByPhone(ctx, phone)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to check existing user: %w", err)
+	}
+	if owner != nil {
+		return nil, "", ErrPhoneInUse
+	}
+
+	return user, phone, nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"otp-auth-backend/models"
+	"otp-auth-backend/store"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionService struct {
+	sessionRepo *store.SessionRepository
+	redisStore  *store.RedisStore
+}
+
+func NewSessionService(sessionRepo *store.SessionRepository, redisStore *store.RedisStore) *SessionService {
+	return &SessionService{
+		sessionRepo: sessionRepo,
+		redisStore:  redisStore,
+	}
+}
+
+// ListSessions returns the active sessions of a user, flagging the one the
+// request was made with
+func (s *SessionService) ListSessions(ctx context.Context, userID, currentSessionID string) (*models.SessionListResponse, error) {
+	sessions, err := s.sessionRepo.ListActiveByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	response := &models.SessionListResponse{Sessions: make([]models.SessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, session.ToResponse(currentSessionID))
+	}
+
+	return response, nil
+}
+
+// RevokeSession ends one of the user's sessions. Its refresh tokens are
+// revoked and access tokens carrying its ID are rejected from then on.
+func (s *SessionService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	revoked, err := s.sessionRepo.Revoke(ctx, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return ErrSessionNotFound
+	}
+
+	if err := s.redisStore.RevokeRefreshFamily(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session tokens: %w", err)
+	}
+
+	return nil
+}
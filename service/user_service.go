@@ -2,19 +2,42 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
 
 	"otp-auth-backend/models"
 	"otp-auth-backend/store"
+
+	"golang.org/x/text/language"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
+// ProfileValidationError reports a profile field that passed request binding
+// but is still not acceptable
+type ProfileValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ProfileValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
 type UserService struct {
-	userRepo *store.UserRepository
+	userRepo  *store.UserRepository
+	auditRepo *store.AuditRepository
 }
 
-func NewUserService(userRepo *store.UserRepository) *UserService {
+func NewUserService(userRepo *store.UserRepository, auditRepo *store.AuditRepository) *UserService {
 	return &UserService{
-		userRepo: userRepo,
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
 	}
 }
 
@@ -25,7 +48,7 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.UserR
 	}
 
 	if user == nil {
-		return nil, fmt.Errorf("user not found")
+		return nil, ErrUserNotFound
 	}
 
 	response := user.ToResponse()
@@ -51,3 +74,99 @@ func (s *UserService) ListUsers(ctx context.Context, query *models.UserQuery) (*
 
 	return users, nil
 }
+
+// UpdateProfile normalizes and validates the provided profile fields, stores
+// them and returns the updated user
+func (s *UserService) UpdateProfile(ctx context.Context, id string, req *models.UpdateProfileRequest, client models.ClientInfo) (*models.UserResponse, error) {
+	if err := normalizeProfile(req); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.UpdateProfile(ctx, id, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if fields := changedProfileFields(req); fields != "" {
+		recordAudit(ctx, s.auditRepo, models.NewAuditEvent(user.ID, models.AuditEventProfileUpdated, client,
+			map[string]string{"fields": fields}))
+	}
+
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// changedProfileFields lists the fields set in the request, comma separated
+func changedProfileFields(req *models.UpdateProfileRequest) string {
+	var fields []string
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"display_name", req.DisplayName},
+		{"email", req.Email},
+		{"locale", req.Locale},
+		{"timezone", req.Timezone},
+		{"avatar_url", req.AvatarURL},
+	} {
+		if field.value != nil {
+			fields = append(fields, field.name)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// normalizeProfile trims the provided fields and checks their format. Empty
+// values are always accepted since they clear the field.
+func normalizeProfile(req *models.UpdateProfileRequest) error {
+	for _, field := range []*string{req.DisplayName, req.Email, req.Locale, req.Timezone, req.AvatarURL} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+
+	if req.DisplayName != nil {
+		for _, r := range *req.DisplayName {
+			if unicode.IsControl(r) {
+				return &ProfileValidationError{Field: "display_name", Reason: "must not contain control characters"}
+			}
+		}
+	}
+
+	if req.Email != nil && *req.Email != "" {
+		// Only a bare address is accepted, not "Name <address>"
+		addr, err := mail.ParseAddress(*req.Email)
+		if err != nil || addr.Address != *req.Email {
+			return &ProfileValidationError{Field: "email", Reason: "must be a valid email address"}
+		}
+		*req.Email = strings.ToLower(*req.Email)
+	}
+
+	if req.Locale != nil && *req.Locale != "" {
+		tag, err := language.Parse(*req.Locale)
+		if err != nil {
+			return &ProfileValidationError{Field: "locale", Reason: "must be a BCP 47 language tag such as en-US"}
+		}
+		*req.Locale = tag.String()
+	}
+
+	if req.Timezone != nil && *req.Timezone != "" {
+		// LoadLocation also accepts "Local", which depends on the server
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "Local" {
+			return &ProfileValidationError{Field: "timezone", Reason: "must be an IANA time zone such as Europe/Berlin"}
+		}
+	}
+
+	if req.AvatarURL != nil && *req.AvatarURL != "" {
+		u, err := url.Parse(*req.AvatarURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+			return &ProfileValidationError{Field: "avatar_url", Reason: "must be an https URL"}
+		}
+	}
+
+	return nil
+}
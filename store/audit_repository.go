@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"otp-auth-backend/models"
+)
+
+type AuditRepository struct {
+	db *Database
+}
+
+func NewAuditRepository(db *Database) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event metadata: %w", err)
+	}
+
+	query := `
+		INSERT INTO audit_events (id, user_id, event_type, ip_address, user_agent, metadata, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err = r.db.DB.ExecContext(ctx, query,
+		event.ID, event.UserID, event.Type, event.IPAddress, event.UserAgent, metadata, event.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUser returns every audit event of a user, oldest first
+func (r *AuditRepository) ListByUser(ctx context.Context, userID string) ([]models.AuditEvent, error) {
+	query := `
+		SELECT id, user_id, event_type, ip_address, user_agent, metadata, created_at
+		FROM audit_events
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var metadata []byte
+		err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.IPAddress,
+			&event.UserAgent, &metadata, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode audit event metadata: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return events, nil
+}
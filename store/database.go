@@ -4,10 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"otp-auth-backend/config"
+	"otp-auth-backend/migrations"
 
 	"github.com/lib/pq"
 )
@@ -16,7 +17,9 @@ type Database struct {
 	DB *sql.DB
 }
 
-func NewDatabase(cfg *config.DatabaseConfig) (*Database, error) {
+// NewDatabase connects to Postgres and runs the embedded SQL migrations
+// together with goMigrations according to the configured migration mode
+func NewDatabase(cfg *config.DatabaseConfig, goMigrations ...Migration) (*Database, error) {
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
 
@@ -42,49 +45,55 @@ func NewDatabase(cfg *config.DatabaseConfig) (*Database, error) {
 	database := &Database{DB: db}
 
 	// Run migrations
-	if err := database.RunMigrations(); err != nil {
+	if err := database.RunMigrations(cfg.MigrationMode, goMigrations...); err != nil {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	log.Printf("Database connected successfully with pool size: %d/%d", cfg.MaxIdleConns, cfg.MaxOpenConns)
+	slog.Info("Database connected successfully", "max_idle_conns", cfg.MaxIdleConns, "max_open_conns", cfg.MaxOpenConns)
 	return database, nil
 }
 
-func (d *Database) RunMigrations() error {
-	// Create users table
-	createUsersTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id UUID PRIMARY KEY,
-		phone VARCHAR(20) UNIQUE NOT NULL,
-		registered_at TIMESTAMP NOT NULL,
-		created_at TIMESTAMP NOT NULL,
-		updated_at TIMESTAMP NOT NULL
-	);
-	`
-
-	// Create index on phone for faster lookups
-	createPhoneIndex := `
-	CREATE INDEX IF NOT EXISTS idx_users_phone ON users(phone);
-	`
-
-	// Create index on registered_at for sorting
-	createRegisteredAtIndex := `
-	CREATE INDEX IF NOT EXISTS idx_users_registered_at ON users(registered_at);
-	`
-
-	queries := []string{
-		createUsersTable,
-		createPhoneIndex,
-		createRegisteredAtIndex,
+// Migration modes selected by DB_MIGRATION_MODE
+const (
+	MigrationModeUp     = "up"
+	MigrationModeVerify = "verify"
+	MigrationModeOff    = "off"
+)
+
+// RunMigrations brings the schema up to date according to the configured mode:
+// "up" applies pending migrations, "verify" only checks that none are pending
+// and "off" skips migrations. Both "up" and "verify" refuse to start if the
+// database has been migrated by a newer binary.
+func (d *Database) RunMigrations(mode string, goMigrations ...Migration) error {
+	if mode == MigrationModeOff {
+		slog.Info("Database migrations disabled")
+		return nil
+	}
+
+	migrator, err := NewMigrator(d.DB, migrations.FS, goMigrations...)
+	if err != nil {
+		return err
 	}
 
-	for _, query := range queries {
-		if _, err := d.DB.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute migration: %w", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch mode {
+	case MigrationModeUp:
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("Database migrations completed successfully", "applied", applied)
+	case MigrationModeVerify:
+		if err := migrator.Verify(ctx); err != nil {
+			return err
 		}
+		slog.Info("Database schema is up to date")
+	default:
+		return fmt.Errorf("unknown migration mode %q", mode)
 	}
 
-	log.Println("Database migrations completed successfully")
 	return nil
 }
 
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"otp-auth-backend/config"
+	"otp-auth-backend/phone"
+)
+
+// GoMigrations returns the migrations implemented in Go. Their versions share
+// the sequence of the SQL files in the migrations package.
+func GoMigrations(phoneCfg *config.PhoneConfig) []Migration {
+	return []Migration{
+		{
+			Version: 5,
+			Name:    "normalize_phones",
+			UpFunc:  normalizePhones(phoneCfg.DefaultRegion),
+			// Normalization loses the original formatting, so there is
+			// nothing to restore
+			DownFunc: func(ctx context.Context, tx *sql.Tx) error { return nil },
+		},
+	}
+}
+
+// duplicatePhonePrefix marks a phone taken from a newer duplicate account so
+// the oldest one can hold the number. With the 16 characters of the longest
+// E.164 number it still fits the VARCHAR(20) column.
+const duplicatePhonePrefix = "dup:"
+
+// normalizePhones rewrites stored phones to E.164, reading national numbers
+// in the default region. When several users share a number once normalized,
+// whether or not their phone was already in E.164, the oldest account gets it
+// and the others are logged by ID so the duplicates can be merged by hand. A
+// newer duplicate that already held the E.164 form has it replaced by the
+// number with duplicatePhonePrefix; the rest keep their unnormalized phone.
+// Rows whose number cannot be parsed are left unchanged and logged as well.
+func normalizePhones(region string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		type userPhone struct {
+			id    string
+			phone string
+		}
+
+		// The first account of each number in this order is the one that keeps it
+		rows, err := tx.QueryContext(ctx, "SELECT id, phone FROM users ORDER BY registered_at, id")
+		if err != nil {
+			return fmt.Errorf("failed to read user phones: %w", err)
+		}
+
+		var users []userPhone
+		for rows.Next() {
+			var user userPhone
+			if err := rows.Scan(&user.id, &user.phone); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan user phone: %w", err)
+			}
+			users = append(users, user)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating over rows: %w", err)
+		}
+
+		// Group the users by normalized number, oldest first
+		var numbers []string
+		holders := make(map[string][]userPhone)
+		var invalid int
+		for _, user := range users {
+			normalized, err := phone.Normalize(user.phone, region)
+			if err != nil {
+				invalid++
+				slog.Warn("Cannot normalize phone, leaving it unchanged", "user_id", user.id)
+				continue
+			}
+			if _, ok := holders[normalized]; !ok {
+				numbers = append(numbers, normalized)
+			}
+			holders[normalized] = append(holders[normalized], user)
+		}
+
+		query := "UPDATE users SET phone = $2 WHERE id = $1"
+
+		var updated, conflicts int
+		for _, normalized := range numbers {
+			owner, duplicates := holders[normalized][0], holders[normalized][1:]
+
+			if len(duplicates) > 0 {
+				duplicateIDs := make([]string, 0, len(duplicates))
+				for _, duplicate := range duplicates {
+					duplicateIDs = append(duplicateIDs, duplicate.id)
+
+					// Free the number for the owner
+					if duplicate.phone == normalized {
+						if _, err := tx.ExecContext(ctx, query, duplicate.id, duplicatePhonePrefix+normalized); err != nil {
+							return fmt.Errorf("failed to release phone of user %s: %w", duplicate.id, err)
+						}
+					}
+				}
+
+				conflicts += len(duplicates)
+				slog.Warn("Phone belongs to several users, keeping it on the oldest account",
+					"user_id", owner.id, "duplicate_user_ids", duplicateIDs)
+			}
+
+			if owner.phone == normalized {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, query, owner.id, normalized); err != nil {
+				return fmt.Errorf("failed to normalize phone of user %s: %w", owner.id, err)
+			}
+			updated++
+		}
+
+		slog.Info("Normalized user phones", "updated", updated, "invalid", invalid, "conflicts", conflicts)
+		return nil
+	}
+}
@@ -0,0 +1,338 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationLockID is the advisory lock key that serializes migrations across replicas
+const migrationLockID int64 = 7_302_114_551_860_441_203
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// ErrSchemaAhead is returned when the database has migrations this binary does not know about
+var ErrSchemaAhead = errors.New("database schema is ahead of this binary")
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+
+	// UpFunc and DownFunc implement changes that need Go code, such as data
+	// backfills. They run in the migration transaction in place of Up and Down.
+	UpFunc   func(ctx context.Context, tx *sql.Tx) error
+	DownFunc func(ctx context.Context, tx *sql.Tx) error
+}
+
+// MigrationStatus reports which migrations have been applied
+type MigrationStatus struct {
+	Current int64
+	Latest  int64
+	Pending []Migration
+	Unknown []int64
+}
+
+// Migrator applies the embedded SQL migrations and Go migrations and records
+// them in schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator loads SQL migrations from fsys and merges them with the Go
+// migrations, ordered by version
+func NewMigrator(db *sql.DB, fsys fs.FS, goMigrations ...Migration) (*Migrator, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		match := migrationFilePattern.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", file.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file.Name(), err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	for i := range goMigrations {
+		migration := &goMigrations[i]
+		if existing, exists := byVersion[migration.Version]; exists {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", migration.Version, existing.Name, migration.Name)
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" && migration.UpFunc == nil {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every pending migration. It refuses to run if the database
+// already has migrations newer than the ones embedded in this binary.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		status, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if len(status.Unknown) > 0 {
+			return fmt.Errorf("%w: unknown versions %v", ErrSchemaAhead, status.Unknown)
+		}
+
+		for _, migration := range status.Pending {
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the given number of most recently applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		known := make(map[int64]Migration, len(m.migrations))
+		for _, migration := range m.migrations {
+			known[migration.Version] = migration
+		}
+
+		for i := len(versions) - 1; i >= 0 && reverted < steps; i-- {
+			migration, ok := known[versions[i]]
+			if !ok {
+				return fmt.Errorf("%w: cannot revert unknown version %d", ErrSchemaAhead, versions[i])
+			}
+			if migration.Down == "" && migration.DownFunc == nil {
+				return fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+			}
+
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			reverted++
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status compares the applied migrations with the embedded ones
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	var status *MigrationStatus
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		var err error
+		status, err = m.status(ctx, conn)
+		return err
+	})
+
+	return status, err
+}
+
+// Verify fails if there are pending migrations or the schema is ahead of the binary
+func (m *Migrator) Verify(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(status.Unknown) > 0 {
+		return fmt.Errorf("%w: unknown versions %v", ErrSchemaAhead, status.Unknown)
+	}
+
+	if len(status.Pending) > 0 {
+		return fmt.Errorf("database schema is at version %d, %d migrations pending up to version %d",
+			status.Current, len(status.Pending), status.Latest)
+	}
+
+	return nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			slog.Warn("Failed to release migration lock", "error", err)
+		}
+	}()
+
+	createTable := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);
+	`
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) ([]int64, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []int64
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to scan migration version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) (*MigrationStatus, error) {
+	versions, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+
+	status := &MigrationStatus{}
+	known := make(map[int64]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		status.Latest = migration.Version
+		if applied[migration.Version] {
+			status.Current = migration.Version
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	for _, version := range versions {
+		if !known[version] {
+			status.Unknown = append(status.Unknown, version)
+		}
+	}
+
+	return status, nil
+}
+
+// apply runs one migration in a transaction together with its bookkeeping
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	script, fn, direction := migration.Up, migration.UpFunc, "up"
+	if !up {
+		script, fn, direction = migration.Down, migration.DownFunc, "down"
+	}
+
+	if fn != nil {
+		err = fn(ctx, tx)
+	} else {
+		_, err = tx.ExecContext(ctx, script)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run migration %d_%s (%s): %w", migration.Version, migration.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+			migration.Version, migration.Name, time.Now())
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	slog.Info("Applied migration", "version", migration.Version, "name", migration.Name, "direction", direction)
+	return nil
+}
@@ -0,0 +1,488 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), PoolSize: 64})
+	t.Cleanup(func() { client.Close() })
+
+	return &RedisStore{client: client}, mr
+}
+
+type otpCheck struct {
+	result   OTPCheckResult
+	attempts int64
+}
+
+// verifyConcurrently starts n verifications of candidate at the same time and
+// returns their outcomes
+func verifyConcurrently(t *testing.T, store *RedisStore, phone string, maxAttempts, n int, candidate string) []otpCheck {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	checks := make(chan otpCheck, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			result, attempts, err := store.VerifyAndConsumeOTP(context.Background(), phone, maxAttempts, time.Hour, candidate)
+			if err != nil {
+				t.Errorf("VerifyAndConsumeOTP: %v", err)
+				return
+			}
+			checks <- otpCheck{result: result, attempts: attempts}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(checks)
+
+	var results []otpCheck
+	for check := range checks {
+		results = append(results, check)
+	}
+	if len(results) != n {
+		t.Fatalf("got %d results, want %d", len(results), n)
+	}
+	return results
+}
+
+func countResults(checks []otpCheck) map[OTPCheckResult]int {
+	counts := map[OTPCheckResult]int{}
+	for _, check := range checks {
+		counts[check.result]++
+	}
+	return counts
+}
+
+func TestVerifyAndConsumeOTPConcurrentCorrectCode(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	const phone, code, verifiers = "+15550100000", "h1:0123abcd", 50
+
+	if err := store.SetOTP(context.Background(), phone, code, "sealed", time.Minute); err != nil {
+		t.Fatalf("SetOTP: %v", err)
+	}
+
+	counts := countResults(verifyConcurrently(t, store, phone, 3, verifiers, code))
+
+	if counts[OTPCheckMatched] != 1 {
+		t.Errorf("%d verifiers matched, want exactly 1", counts[OTPCheckMatched])
+	}
+	if counts[OTPCheckNotFound] != verifiers-1 {
+		t.Errorf("%d verifiers found no code, want %d", counts[OTPCheckNotFound], verifiers-1)
+	}
+
+	// The winner consumed the code; losers must not have counted attempts
+	for _, key := range []string{"otp:" + phone, otpAttemptsKey(phone), otpResendKey(phone)} {
+		if mr.Exists(key) {
+			t.Errorf("%s still exists after the code was consumed", key)
+		}
+	}
+}
+
+func TestVerifyAndConsumeOTPConcurrentWrongCodes(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	const phone, verifiers = "+15550100000", 20
+
+	if err := store.SetOTP(context.Background(), phone, "h1:right", "", time.Minute); err != nil {
+		t.Fatalf("SetOTP: %v", err)
+	}
+
+	checks := verifyConcurrently(t, store, phone, verifiers+1, verifiers, "h1:wrong")
+
+	// Every failure is counted exactly once
+	attempts := make([]int, 0, len(checks))
+	for _, check := range checks {
+		if check.result != OTPCheckMismatch {
+			t.Fatalf("result %d, want mismatch", check.result)
+		}
+		attempts = append(attempts, int(check.attempts))
+	}
+	sort.Ints(attempts)
+	for i, got := range attempts {
+		if got != i+1 {
+			t.Fatalf("attempt counts %v, want 1..%d each once", attempts, verifiers)
+		}
+	}
+
+	stored, err := mr.Get(otpAttemptsKey(phone))
+	if err != nil || stored != "20" {
+		t.Errorf("attempt counter = %q (%v), want 20", stored, err)
+	}
+	if !mr.Exists("otp:" + phone) {
+		t.Error("code was deleted before reaching the attempt limit")
+	}
+}
+
+func TestVerifyAndConsumeOTPConcurrentExhaustion(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	const phone, maxAttempts, verifiers = "+15550100000", 3, 10
+
+	if err := store.SetOTP(context.Background(), phone, "h1:right", "", time.Minute); err != nil {
+		t.Fatalf("SetOTP: %v", err)
+	}
+
+	counts := countResults(verifyConcurrently(t, store, phone, maxAttempts, verifiers, "h1:wrong"))
+
+	want := map[OTPCheckResult]int{
+		OTPCheckMismatch:  maxAttempts - 1,
+		OTPCheckExhausted: 1,
+		OTPCheckNotFound:  verifiers - maxAttempts,
+	}
+	for result, n := range want {
+		if counts[result] != n {
+			t.Errorf("result %d: got %d, want %d (all: %v)", result, counts[result], n, counts)
+		}
+	}
+
+	if mr.Exists("otp:"+phone) || mr.Exists(otpAttemptsKey(phone)) {
+		t.Error("burned code or its attempt counter was not deleted")
+	}
+}
+
+func TestVerifyAndConsumeOTPCandidates(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     string
+		candidates []string
+		want       OTPCheckResult
+	}{
+		{"hash matches", "h1:abcd", []string{"h1:abcd"}, OTPCheckMatched},
+		{"plaintext fallback matches", "123456", []string{"h1:abcd", "123456"}, OTPCheckMatched},
+		{"prefix does not match", "123456", []string{"12345"}, OTPCheckMismatch},
+		{"longer value does not match", "123456", []string{"1234567"}, OTPCheckMismatch},
+		{"last byte differs", "h1:abcd", []string{"h1:abce"}, OTPCheckMismatch},
+		{"no candidates", "h1:abcd", nil, OTPCheckMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _ := newTestRedisStore(t)
+			ctx := context.Background()
+			const phone = "+15550100000"
+
+			if err := store.SetOTP(ctx, phone, tt.stored, "", time.Minute); err != nil {
+				t.Fatalf("SetOTP: %v", err)
+			}
+
+			got, _, err := store.VerifyAndConsumeOTP(ctx, phone, 3, time.Hour, tt.candidates...)
+			if err != nil {
+				t.Fatalf("VerifyAndConsumeOTP: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got result %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAndConsumeOTPAttemptsSpanCodes(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	ctx := context.Background()
+	const phone, maxAttempts = "+15550100000", 3
+
+	// Guessing on one code, then asking for a new one, does not reset the count
+	for i := 1; i < maxAttempts; i++ {
+		if err := store.SetOTP(ctx, phone, "h1:right", "", time.Minute); err != nil {
+			t.Fatalf("SetOTP: %v", err)
+		}
+		result, attempts, err := store.VerifyAndConsumeOTP(ctx, phone, maxAttempts, time.Hour, "h1:wrong")
+		if err != nil {
+			t.Fatalf("VerifyAndConsumeOTP: %v", err)
+		}
+		if result != OTPCheckMismatch || attempts != int64(i) {
+			t.Fatalf("guess %d: result %d with %d attempts, want mismatch with %d", i, result, attempts, i)
+		}
+	}
+
+	if err := store.SetOTP(ctx, phone, "h1:right", "", time.Minute); err != nil {
+		t.Fatalf("SetOTP: %v", err)
+	}
+	if ttl := mr.TTL(otpAttemptsKey(phone)); ttl != time.Hour {
+		t.Errorf("attempt counter TTL = %v, want the window", ttl)
+	}
+
+	result, _, err := store.VerifyAndConsumeOTP(ctx, phone, maxAttempts, time.Hour, "h1:wrong")
+	if err != nil {
+		t.Fatalf("VerifyAndConsumeOTP: %v", err)
+	}
+	if result != OTPCheckExhausted {
+		t.Errorf("result %d, want exhausted on the last guess across codes", result)
+	}
+
+	// The counter starts over once the window has passed
+	if err := store.SetOTP(ctx, phone, "h1:right", "", time.Minute); err != nil {
+		t.Fatalf("SetOTP: %v", err)
+	}
+	if _, _, err := store.VerifyAndConsumeOTP(ctx, phone, maxAttempts, time.Hour, "h1:wrong"); err != nil {
+		t.Fatalf("VerifyAndConsumeOTP: %v", err)
+	}
+	mr.FastForward(time.Hour)
+	if mr.Exists(otpAttemptsKey(phone)) {
+		t.Error("attempt counter outlived the window")
+	}
+}
+
+func TestConsumeRefreshTokenRotation(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	ctx := context.Background()
+	record := RefreshTokenRecord{UserID: "user-1", FamilyID: "family-1"}
+
+	if err := store.CreateRefreshFamily(ctx, record.FamilyID, record.UserID, time.Hour); err != nil {
+		t.Fatalf("CreateRefreshFamily: %v", err)
+	}
+	for _, hash := range []string{"first", "second"} {
+		saved, err := store.SaveRefreshToken(ctx, hash, record, time.Hour)
+		if err != nil || !saved {
+			t.Fatalf("SaveRefreshToken(%s) = %v, %v", hash, saved, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want RefreshTokenStatus
+	}{
+		{"first use", "first", RefreshTokenValid},
+		{"replay", "first", RefreshTokenReused},
+		{"replay again", "first", RefreshTokenReused},
+		{"rotated token", "second", RefreshTokenValid},
+		{"unknown token", "unknown", RefreshTokenNotFound},
+	}
+
+	for _, tt := range tests {
+		status, got, err := store.ConsumeRefreshToken(ctx, tt.hash)
+		if err != nil {
+			t.Fatalf("%s: ConsumeRefreshToken: %v", tt.name, err)
+		}
+		if status != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, status, tt.want)
+		}
+		if status != RefreshTokenNotFound && *got != record {
+			t.Errorf("%s: record %+v, want %+v", tt.name, *got, record)
+		}
+	}
+}
+
+func TestConsumeRefreshTokenConcurrent(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	ctx := context.Background()
+	const consumers = 50
+	record := RefreshTokenRecord{UserID: "user-1", FamilyID: "family-1"}
+
+	if err := store.CreateRefreshFamily(ctx, record.FamilyID, record.UserID, time.Hour); err != nil {
+		t.Fatalf("CreateRefreshFamily: %v", err)
+	}
+	if _, err := store.SaveRefreshToken(ctx, "token", record, time.Hour); err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	statuses := make(chan RefreshTokenStatus, consumers)
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			status, _, err := store.ConsumeRefreshToken(ctx, "token")
+			if err != nil {
+				t.Errorf("ConsumeRefreshToken: %v", err)
+				return
+			}
+			statuses <- status
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(statuses)
+
+	counts := map[RefreshTokenStatus]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[RefreshTokenValid] != 1 || counts[RefreshTokenReused] != consumers-1 {
+		t.Errorf("got %v, want exactly one valid and the rest reused", counts)
+	}
+}
+
+func TestRevokeRefreshFamily(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	ctx := context.Background()
+	revoked := RefreshTokenRecord{UserID: "user-1", FamilyID: "family-1"}
+	other := RefreshTokenRecord{UserID: "user-1", FamilyID: "family-2"}
+
+	for _, record := range []RefreshTokenRecord{revoked, other} {
+		if err := store.CreateRefreshFamily(ctx, record.FamilyID, record.UserID, time.Hour); err != nil {
+			t.Fatalf("CreateRefreshFamily: %v", err)
+		}
+		if _, err := store.SaveRefreshToken(ctx, record.FamilyID+"-token", record, time.Hour); err != nil {
+			t.Fatalf("SaveRefreshToken: %v", err)
+		}
+	}
+
+	if err := store.RevokeRefreshFamily(ctx, revoked.FamilyID); err != nil {
+		t.Fatalf("RevokeRefreshFamily: %v", err)
+	}
+
+	status, _, err := store.ConsumeRefreshToken(ctx, revoked.FamilyID+"-token")
+	if err != nil {
+		t.Fatalf("ConsumeRefreshToken: %v", err)
+	}
+	if status != RefreshTokenRevoked {
+		t.Errorf("token of revoked family: status %d, want revoked", status)
+	}
+
+	// A rotation that races the revocation must not bring the family back
+	saved, err := store.SaveRefreshToken(ctx, "late-token", revoked, time.Hour)
+	if err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+	if saved {
+		t.Error("saved a refresh token in a revoked family")
+	}
+
+	status, _, err = store.ConsumeRefreshToken(ctx, other.FamilyID+"-token")
+	if err != nil {
+		t.Fatalf("ConsumeRefreshToken: %v", err)
+	}
+	if status != RefreshTokenValid {
+		t.Errorf("token of another family: status %d, want valid", status)
+	}
+}
+
+func TestGetTokenState(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	ctx := context.Background()
+	const tokenID, userID, familyID = "token-1", "user-1", "family-1"
+
+	state := func() TokenState {
+		t.Helper()
+		state, err := store.GetTokenState(ctx, tokenID, userID, familyID)
+		if err != nil {
+			t.Fatalf("GetTokenState: %v", err)
+		}
+		return *state
+	}
+
+	if got := state(); got != (TokenState{}) {
+		t.Errorf("unknown token: got %+v, want the zero state", got)
+	}
+
+	if err := store.CreateRefreshFamily(ctx, familyID, userID, time.Hour); err != nil {
+		t.Fatalf("CreateRefreshFamily: %v", err)
+	}
+	if got := state(); got != (TokenState{SessionActive: true}) {
+		t.Errorf("active session: got %+v", got)
+	}
+
+	// Logout revokes the token and its session
+	if err := store.RevokeToken(ctx, tokenID, time.Minute); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if err := store.RevokeRefreshFamily(ctx, familyID); err != nil {
+		t.Fatalf("RevokeRefreshFamily: %v", err)
+	}
+	if got := state(); got != (TokenState{Revoked: true}) {
+		t.Errorf("after logout: got %+v", got)
+	}
+
+	// Logout-all bumps the version and drops every session of the user
+	if err := store.CreateRefreshFamily(ctx, familyID, userID, time.Hour); err != nil {
+		t.Fatalf("CreateRefreshFamily: %v", err)
+	}
+	if err := store.CreateRefreshFamily(ctx, "family-2", userID, time.Hour); err != nil {
+		t.Fatalf("CreateRefreshFamily: %v", err)
+	}
+	if _, err := store.IncrementTokenVersion(ctx, userID); err != nil {
+		t.Fatalf("IncrementTokenVersion: %v", err)
+	}
+	if err := store.RevokeAllRefreshFamilies(ctx, userID); err != nil {
+		t.Fatalf("RevokeAllRefreshFamilies: %v", err)
+	}
+	if got := state(); got != (TokenState{Revoked: true, Version: 1}) {
+		t.Errorf("after logout-all: got %+v", got)
+	}
+	other, err := store.GetTokenState(ctx, "token-2", userID, "family-2")
+	if err != nil {
+		t.Fatalf("GetTokenState: %v", err)
+	}
+	if other.SessionActive {
+		t.Error("logout-all left another session active")
+	}
+}
+
+func TestRevokeTokenExpires(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	ctx := context.Background()
+
+	if err := store.RevokeToken(ctx, "expired", 0); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if mr.Exists(revokedTokenKey("expired")) {
+		t.Error("stored a revocation for a token that has already expired")
+	}
+
+	if err := store.RevokeToken(ctx, "token", time.Minute); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if ttl := mr.TTL(revokedTokenKey("token")); ttl != time.Minute {
+		t.Errorf("revocation TTL = %v, want the remaining token lifetime", ttl)
+	}
+}
+
+func TestAccountBlock(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	ctx := context.Background()
+	const userID = "user-1"
+
+	blockedStatus := func() string {
+		t.Helper()
+		state, err := store.GetTokenState(ctx, "token-1", userID, "family-1")
+		if err != nil {
+			t.Fatalf("GetTokenState: %v", err)
+		}
+		return state.BlockedStatus
+	}
+
+	if err := store.SetAccountBlock(ctx, userID, "banned", 0); err != nil {
+		t.Fatalf("SetAccountBlock: %v", err)
+	}
+	mr.FastForward(24 * time.Hour)
+	if got := blockedStatus(); got != "banned" {
+		t.Errorf("block without expiry: status %q, want banned", got)
+	}
+
+	if err := store.ClearAccountBlock(ctx, userID); err != nil {
+		t.Fatalf("ClearAccountBlock: %v", err)
+	}
+	if got := blockedStatus(); got != "" {
+		t.Errorf("lifted block: status %q, want none", got)
+	}
+
+	// A suspension with an end lifts itself
+	if err := store.SetAccountBlock(ctx, userID, "suspended", time.Hour); err != nil {
+		t.Fatalf("SetAccountBlock: %v", err)
+	}
+	if got := blockedStatus(); got != "suspended" {
+		t.Errorf("suspension: status %q, want suspended", got)
+	}
+	mr.FastForward(time.Hour)
+	if got := blockedStatus(); got != "" {
+		t.Errorf("expired suspension: status %q, want none", got)
+	}
+}
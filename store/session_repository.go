@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"otp-auth-backend/models"
+)
+
+type SessionRepository struct {
+	db *Database
+}
+
+func NewSessionRepository(db *Database) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, device_label, ip_address, user_agent, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := r.db.DB.ExecContext(ctx, query,
+		session.ID, session.UserID, session.DeviceLabel, session.IPAddress, session.UserAgent,
+		session.CreatedAt, session.LastSeenAt, session.ExpiresAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
+
+// ListActiveByUser returns the sessions of a user that are neither revoked nor expired
+func (r *SessionRepository) ListActiveByUser(ctx context.Context, userID string) ([]models.Session, error) {
+	query := `
+		SELECT id, user_id, device_label, ip_address, user_agent, created_at, last_seen_at, expires_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_seen_at DESC
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.DeviceLabel, &session.IPAddress,
+			&session.UserAgent, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// ListByUser returns every session of a user, including revoked and expired
+// ones, newest first
+func (r *SessionRepository) ListByUser(ctx context.Context, userID string) ([]models.Session, error) {
+	query := `
+		SELECT id, user_id, device_label, ip_address, user_agent, created_at, last_seen_at, expires_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.DeviceLabel, &session.IPAddress,
+			&session.UserAgent, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// Touch records that a session has been used again
+func (r *SessionRepository) Touch(ctx context.Context, id string, client models.ClientInfo, expiresAt time.Time) error {
+	query := `
+		UPDATE sessions
+		SET ip_address = $2, user_agent = $3, last_seen_at = $4, expires_at = $5
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := r.db.DB.ExecContext(ctx, query,
+		id, client.IPAddress, models.TruncateUserAgent(client.UserAgent), time.Now(), expiresAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	return nil
+}
+
+// Revoke marks a session of the given user as revoked. It returns false if
+// the user has no such active session.
+func (r *SessionRepository) Revoke(ctx context.Context, id, userID string) (bool, error) {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $3
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, id, userID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// RevokeAllByUser marks every active session of a user as revoked
+func (r *SessionRepository) RevokeAllByUser(ctx context.Context, userID string) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $2
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := r.db.DB.ExecContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
@@ -3,12 +3,47 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"otp-auth-backend/models"
+	"otp-auth-backend/phone"
+	"otp-auth-backend/tracing"
+
+	"github.com/google/uuid"
 )
 
+// userColumns lists the users columns in the order scanUser reads them
+const userColumns = `id, phone, role, display_name, email, locale, timezone, avatar_url,
+		status, status_reason, status_expires_at, registered_at, created_at, updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser reads a row selected with userColumns
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(&user.ID, &user.Phone, &user.Role,
+		&user.DisplayName, &user.Email, &user.Locale, &user.Timezone, &user.AvatarURL,
+		&user.Status, &user.StatusReason, &user.StatusExpiresAt,
+		&user.RegisteredAt, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ErrPhoneTaken is returned when a phone is already registered to another user
+var ErrPhoneTaken = errors.New("phone number is already registered")
+
+// phoneSearchReplacer strips the formatting characters people type in phone
+// numbers so that searches match the stored E.164 form
+var phoneSearchReplacer = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
 type UserRepository struct {
 	db *Database
 }
@@ -17,14 +52,23 @@ func NewUserRepository(db *Database) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+func (r *UserRepository) Create(ctx context.Context, user *models.User) (err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.Create")
+	defer tracing.End(span, &err)
+
+	// Phones are normalized by the service layer; anything else would create
+	// a second account for the same number
+	if !phone.IsE164(user.Phone) {
+		return fmt.Errorf("failed to create user: phone is not in E.164 format")
+	}
+
 	query := `
-		INSERT INTO users (id, phone, registered_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO users (id, phone, role, registered_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
 
-	_, err := r.db.DB.ExecContext(ctx, query,
-		user.ID, user.Phone, user.RegisteredAt, user.CreatedAt, user.UpdatedAt)
+	_, err = r.db.DB.ExecContext(ctx, query,
+		user.ID, user.Phone, user.Role, user.RegisteredAt, user.CreatedAt, user.UpdatedAt)
 
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
@@ -33,16 +77,22 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	return nil
 }
 
-func (r *UserRepository) GetByPhone(ctx context.Context, phone string) (*models.User, error) {
+// GetByPhone looks a user up by E.164 phone number
+func (r *UserRepository) GetByPhone(ctx context.Context, e164 string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetByPhone")
+	defer tracing.End(span, &err)
+
+	if !phone.IsE164(e164) {
+		return nil, fmt.Errorf("failed to get user by phone: phone is not in E.164 format")
+	}
+
 	query := `
-		SELECT id, phone, registered_at, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
-		WHERE phone = $1
+		WHERE phone = $1 AND deleted_at IS NULL
 	`
 
-	user := &models.User{}
-	err := r.db.DB.QueryRowContext(ctx, query, phone).Scan(
-		&user.ID, &user.Phone, &user.RegisteredAt, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(r.db.DB.QueryRowContext(ctx, query, e164))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -55,16 +105,17 @@ func (r *UserRepository) GetByPhone(ctx context.Context, phone string) (*models.
 	return user, nil
 }
 
-func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetByID")
+	defer tracing.End(span, &err)
+
 	query := `
-		SELECT id, phone, registered_at, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	user := &models.User{}
-	err := r.db.DB.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.Phone, &user.RegisteredAt, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(r.db.DB.QueryRowContext(ctx, query, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -77,21 +128,206 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User,
 	return user, nil
 }
 
-func (r *UserRepository) List(ctx context.Context, query *models.UserQuery) (*models.UserListResponse, error) {
+// UpdateRole changes the role of a user
+func (r *UserRepository) UpdateRole(ctx context.Context, id uuid.UUID, role models.Role) (err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.UpdateRole")
+	defer tracing.End(span, &err)
+
+	query := `
+		UPDATE users
+		SET role = $2
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	_, err = r.db.DB.ExecContext(ctx, query, id, role)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateStatus sets the account status of a user and returns the updated
+// user, or nil if it does not exist
+func (r *UserRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status models.AccountStatus, reason string, expiresAt *time.Time) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.UpdateStatus")
+	defer tracing.End(span, &err)
+
+	query := `
+		UPDATE users
+		SET status = $2, status_reason = $3, status_expires_at = $4
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + userColumns + `
+	`
+
+	user, err := scanUser(r.db.DB.QueryRowContext(ctx, query, id, status, reason, expiresAt))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdatePhone moves a user to another E.164 phone and returns the updated
+// user, or nil if it does not exist. The unique constraint on phone decides
+// races between users claiming the same number.
+func (r *UserRepository) UpdatePhone(ctx context.Context, id uuid.UUID, e164 string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.UpdatePhone")
+	defer tracing.End(span, &err)
+
+	if !phone.IsE164(e164) {
+		return nil, fmt.Errorf("failed to update user phone: phone is not in E.164 format")
+	}
+
+	query := `
+		UPDATE users
+		SET phone = $2
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + userColumns + `
+	`
+
+	user, err := scanUser(r.db.DB.QueryRowContext(ctx, query, id, e164))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if r.db.IsDuplicateKeyError(err) {
+		return nil, ErrPhoneTaken
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user phone: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateProfile sets the profile fields present in the request and returns
+// the updated user, or nil if it does not exist. Fields left nil keep their
+// value; updated_at is maintained by the users_set_updated_at trigger.
+func (r *UserRepository) UpdateProfile(ctx context.Context, id string, req *models.UpdateProfileRequest) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.UpdateProfile")
+	defer tracing.End(span, &err)
+
+	fields := []struct {
+		column string
+		value  *string
+	}{
+		{"display_name", req.DisplayName},
+		{"email", req.Email},
+		{"locale", req.Locale},
+		{"timezone", req.Timezone},
+		{"avatar_url", req.AvatarURL},
+	}
+
+	var sets []string
+	args := []interface{}{id}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		args = append(args, *field.value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", field.column, len(args)))
+	}
+
+	// Nothing to change: return the current record without touching updated_at
+	if len(sets) == 0 {
+		return r.GetByID(ctx, id)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE users
+		SET %s
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING %s
+	`, strings.Join(sets, ", "), userColumns)
+
+	user, err := scanUser(r.db.DB.QueryRowContext(ctx, query, args...))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user profile: %w", err)
+	}
+
+	return user, nil
+}
+
+// SoftDelete marks a user as deleted and schedules the row for purging. It
+// returns false if the user does not exist or is already deleted.
+func (r *UserRepository) SoftDelete(ctx context.Context, id uuid.UUID, purgeAfter time.Time) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.SoftDelete")
+	defer tracing.End(span, &err)
+
+	query := `
+		UPDATE users
+		SET deleted_at = $2, purge_after = $3
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, id, time.Now(), purgeAfter)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// PurgeDeleted removes up to limit deleted users whose purge time has
+// passed, with their sessions and audit events, and returns how many it removed
+func (r *UserRepository) PurgeDeleted(ctx context.Context, now time.Time, limit int) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.PurgeDeleted")
+	defer tracing.End(span, &err)
+
+	query := `
+		DELETE FROM users
+		WHERE id IN (
+			SELECT id FROM users
+			WHERE deleted_at IS NOT NULL AND purge_after <= $1
+			ORDER BY purge_after
+			LIMIT $2
+		)
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, now, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (r *UserRepository) List(ctx context.Context, query *models.UserQuery) (_ *models.UserListResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.List")
+	defer tracing.End(span, &err)
+
 	// Build the base query
 	baseQuery := `
-		SELECT id, phone, registered_at, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 	`
 
-	// Build WHERE clause for search
-	var whereClause string
+	// Build WHERE clause for search; deleted accounts are never listed
+	whereClause := "WHERE deleted_at IS NULL"
 	var args []interface{}
 	argCount := 1
 
 	if query.Query != "" {
-		whereClause = fmt.Sprintf("WHERE phone ILIKE $%d", argCount)
-		args = append(args, "%"+query.Query+"%")
+		whereClause += fmt.Sprintf(" AND phone ILIKE $%d", argCount)
+		args = append(args, "%"+phoneSearchReplacer.Replace(query.Query)+"%")
 		argCount++
 	}
 
@@ -109,7 +345,7 @@ func (r *UserRepository) List(ctx context.Context, query *models.UserQuery) (*mo
 	// Get total count
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM users %s", whereClause)
 	var total int
-	err := r.db.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	err = r.db.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
@@ -143,8 +379,7 @@ func (r *UserRepository) List(ctx context.Context, query *models.UserQuery) (*mo
 
 	var users []models.UserResponse
 	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.Phone, &user.RegisteredAt, &user.CreatedAt, &user.UpdatedAt)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook creates a span for every Redis command and pipeline. Only command
+// names are recorded: arguments hold phone numbers and token hashes.
+type RedisHook struct{}
+
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := startRedisSpan(ctx, "redis "+cmd.Name(), cmd.Name())
+		err := next(ctx, cmd)
+		endRedisSpan(span, err)
+		return err
+	}
+}
+
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+
+		ctx, span := startRedisSpan(ctx, "redis pipeline", strings.Join(names, " "))
+		span.SetAttributes(attribute.Int("db.redis.pipeline_length", len(cmds)))
+		err := next(ctx, cmds)
+		endRedisSpan(span, err)
+		return err
+	}
+}
+
+func startRedisSpan(ctx context.Context, name, operation string) (context.Context, trace.Span) {
+	ctx, span := Start(ctx, name)
+	span.SetAttributes(
+		semconv.DBSystemRedis,
+		semconv.DBOperationName(operation),
+	)
+	return ctx, span
+}
+
+func endRedisSpan(span trace.Span, err error) {
+	// A missing key is a normal result, not a failure
+	if err == redis.Nil {
+		err = nil
+	}
+	End(span, &err)
+}
+
+var _ redis.Hook = RedisHook{}